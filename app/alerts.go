@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	alertMetricConsensus = "consensus"
+	alertMetricForecasts = "forecasts"
+	alertMetricDeviation = "deviation"
+
+	alertConditionAbove        = "above"
+	alertConditionBelow        = "below"
+	alertConditionCrosses      = "crosses"
+	alertConditionCrossesAbove = "crossesAbove"
+	alertConditionCrossesBelow = "crossesBelow"
+
+	alertAnyTicker = "*"
+)
+
+var alerts = newAlertNotifier()
+
+// alertRule is a parsed rule of Alerts.Rules configuration parameter.
+type alertRule struct {
+	raw       string
+	ticker    string
+	metric    string
+	condition string
+	threshold float64
+}
+
+// parseAlertRules parses rules separated by ';' or new lines. Every rule looks like
+// "<ticker or *> <metric> <condition> <threshold>", for example:
+//
+//	SBER consensus crosses 25       consensus of SBER crosses +25% in any direction
+//	* forecasts crossesBelow 5      actual forecasts count of any ticker drops below 5
+//	* deviation above 30            a new forecast is more than 30% away from consensus
+//
+// Metrics are consensus, forecasts and deviation. Conditions are above and below which match every
+// time, and crosses, crossesAbove and crossesBelow which match only when the value crosses the threshold.
+func parseAlertRules(raw string) ([]alertRule, error) {
+	var rules []alertRule
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("alert rule %q must have 4 fields: <ticker or *> <metric> <condition> <threshold>", line)
+		}
+
+		rule := alertRule{
+			raw:       strings.Join(fields, " "),
+			ticker:    fields[0],
+			metric:    fields[1],
+			condition: fields[2],
+		}
+
+		switch rule.metric {
+		case alertMetricConsensus, alertMetricForecasts, alertMetricDeviation:
+		default:
+			return nil, fmt.Errorf("alert rule %q has unknown metric %s, expected %s, %s or %s",
+				line, rule.metric, alertMetricConsensus, alertMetricForecasts, alertMetricDeviation)
+		}
+
+		switch rule.condition {
+		case alertConditionAbove, alertConditionBelow:
+		case alertConditionCrosses, alertConditionCrossesAbove, alertConditionCrossesBelow:
+			if rule.metric == alertMetricDeviation {
+				return nil, fmt.Errorf("alert rule %q: deviation supports %s and %s conditions only",
+					line, alertConditionAbove, alertConditionBelow)
+			}
+		default:
+			return nil, fmt.Errorf("alert rule %q has unknown condition %s", line, rule.condition)
+		}
+
+		threshold, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSuffix(fields[3], "%"), "+"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %q has wrong threshold: %w", line, err)
+		}
+		rule.threshold = threshold
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (ptr *alertRule) matchesTicker(short string) bool {
+	return ptr.ticker == alertAnyTicker || strings.EqualFold(ptr.ticker, short)
+}
+
+// check compares the value with the threshold, previous value is needed by crossing conditions only.
+func (ptr *alertRule) check(value float64, previous *float64) bool {
+	crossedAbove := previous != nil && *previous <= ptr.threshold && value > ptr.threshold
+	crossedBelow := previous != nil && *previous >= ptr.threshold && value < ptr.threshold
+
+	switch ptr.condition {
+	case alertConditionAbove:
+		return value > ptr.threshold
+	case alertConditionBelow:
+		return value < ptr.threshold
+	case alertConditionCrossesAbove:
+		return crossedAbove
+	case alertConditionCrossesBelow:
+		return crossedBelow
+	case alertConditionCrosses:
+		return crossedAbove || crossedBelow
+	}
+	return false
+}
+
+func (ptr *alertRule) newAlert(at time.Time, ticker string, value float64, previous *float64, forecastID string) entities.Alert {
+	alert := entities.Alert{
+		Rule:       ptr.raw,
+		Ticker:     ticker,
+		Metric:     ptr.metric,
+		Condition:  ptr.condition,
+		Threshold:  ptr.threshold,
+		Value:      value,
+		Previous:   previous,
+		ForecastID: forecastID,
+		Time:       at,
+	}
+	hash := sha1.Sum([]byte(alertDedupKey(alert) + "|" + at.UTC().Format(time.RFC3339Nano)))
+	alert.ID = hex.EncodeToString(hash[:8])
+	return alert
+}
+
+// alertDedupKey identifies alerts which are suppressed within the dedup window.
+func alertDedupKey(alert entities.Alert) string {
+	return alert.Rule + "|" + strings.ToUpper(alert.Ticker) + "|" + alert.ForecastID
+}
+
+// evaluateAlerts checks the rules against the scrape. Consensus and forecasts are compared with
+// the previous scrape, deviation is checked for new forecasts of the scrape only.
+func evaluateAlerts(rules []alertRule, event *scrapeEvent) []entities.Alert {
+	previousTickers := make(map[string]tickerRecord)
+	if event.Previous != nil {
+		for _, ticker := range event.Previous.Tickers {
+			previousTickers[ticker.Name.Short] = ticker
+		}
+	}
+
+	current := event.Current
+	var result []entities.Alert
+	for _, ticker := range current.Tickers {
+		short := ticker.Name.Short
+		previousTicker, hasPrevious := previousTickers[short]
+
+		for i := range rules {
+			rule := &rules[i]
+			if !rule.matchesTicker(short) {
+				continue
+			}
+
+			switch rule.metric {
+			case alertMetricConsensus:
+				if ticker.Consensus == nil {
+					continue
+				}
+				var previous *float64
+				if hasPrevious {
+					previous = previousTicker.Consensus
+				}
+				if rule.check(*ticker.Consensus, previous) {
+					result = append(result, rule.newAlert(current.Time, short, *ticker.Consensus, previous, ""))
+				}
+
+			case alertMetricForecasts:
+				value := float64(len(actualForecasts(ticker.Forecasts, current.Time)))
+				var previous *float64
+				if hasPrevious {
+					count := float64(len(actualForecasts(previousTicker.Forecasts, event.Previous.Time)))
+					previous = &count
+				}
+				if rule.check(value, previous) {
+					result = append(result, rule.newAlert(current.Time, short, value, previous, ""))
+				}
+
+			case alertMetricDeviation:
+				if ticker.Consensus == nil {
+					continue
+				}
+				for _, forecast := range newForecasts(event.Changes, ticker) {
+					value := math.Abs(forecast.ExpectedDiff - *ticker.Consensus)
+					if rule.check(value, nil) {
+						result = append(result, rule.newAlert(current.Time, short, value, nil, forecast.ID))
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// newForecasts returns forecasts of the ticker which are reported as new by the changes.
+func newForecasts(changes []entities.ForecastChange, ticker tickerRecord) []forecast {
+	ids := make(map[string]bool)
+	for _, change := range changes {
+		if change.Type == changeTypeNew && change.Ticker == ticker.Name.Short {
+			ids[change.ForecastID] = true
+		}
+	}
+
+	var result []forecast
+	for _, forecast := range ticker.Forecasts {
+		if ids[forecast.ID] {
+			result = append(result, forecast)
+		}
+	}
+	return result
+}
+
+// checkAlerts evaluates configured rules against the scrape and sends matches to the webhooks.
+func checkAlerts(event *scrapeEvent) {
+	rules, err := parseAlertRules(getProperties().Alerts.Rules)
+	if err != nil {
+		alertsLog.Errorf("cannot check alerts: %s", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	matched := evaluateAlerts(rules, event)
+	alertsLog.Debugf("%d alerts matched by scrape at %s", len(matched), event.Current.Time)
+	alerts.notify(matched)
+}
+
+// alertNotifier delivers alerts to the webhooks suppressing repeated ones within the dedup window.
+type alertNotifier struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+func newAlertNotifier() *alertNotifier {
+	return &alertNotifier{sent: make(map[string]time.Time)}
+}
+
+// notify sends alerts which have not been sent within the dedup window to all webhooks in background.
+func (ptr *alertNotifier) notify(matched []entities.Alert) {
+	properties := getProperties().Alerts
+	window := time.Duration(properties.DedupWindow) * time.Second
+
+	var webhooks []string
+	for _, url := range strings.Split(properties.Webhooks, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			webhooks = append(webhooks, url)
+		}
+	}
+
+	for _, alert := range matched {
+		if !ptr.fresh(alertDedupKey(alert), alert.Time, window) {
+			alertsLog.Debugf("alert %s for %s suppressed by dedup window", alert.Rule, alert.Ticker)
+			continue
+		}
+		alertsLog.Infof("alert %s matched for %s: %f", alert.Rule, alert.Ticker, alert.Value)
+
+		for _, url := range webhooks {
+			go func(url string, alert entities.Alert) {
+				if err := deliverAlert(url, properties.Secret, alert, int(properties.Retries),
+					time.Duration(properties.Backoff)*time.Second); err != nil {
+					alertsLog.Errorf("cannot deliver alert %s to %s: %s", alert.ID, redactString(redactURLs, url), err)
+				}
+			}(url, alert)
+		}
+	}
+}
+
+// fresh reports if the key has not been sent within the window and remembers it as sent at given time.
+func (ptr *alertNotifier) fresh(key string, at time.Time, window time.Duration) bool {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	for sentKey, sentAt := range ptr.sent {
+		if at.Sub(sentAt) >= window {
+			delete(ptr.sent, sentKey)
+		}
+	}
+
+	if _, ok := ptr.sent[key]; ok {
+		return false
+	}
+	ptr.sent[key] = at
+	return true
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+func Test_parseAlertRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "empty rules", raw: ""},
+		{name: "rules separated by semicolon and new line", raw: "SBER consensus crosses +25%; * forecasts crossesBelow 5\n* deviation above 30", wantCount: 3},
+		{name: "wrong fields count", raw: "SBER consensus 25", wantErr: true},
+		{name: "unknown metric", raw: "SBER price above 25", wantErr: true},
+		{name: "unknown condition", raw: "SBER consensus equals 25", wantErr: true},
+		{name: "crossing deviation", raw: "* deviation crosses 30", wantErr: true},
+		{name: "wrong threshold", raw: "SBER consensus above many", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAlertRules(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAlertRules() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("parseAlertRules() got %d rules, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func Test_evaluateAlerts(t *testing.T) {
+	at := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	consensus := func(value float64) *float64 {
+		return &value
+	}
+	forecasts := func(count int, diff float64) []forecast {
+		var result []forecast
+		for i := 0; i < count; i++ {
+			result = append(result, forecast{ID: string(rune('a' + i)), ExpectedDiff: diff, Time: at})
+		}
+		return result
+	}
+
+	event := &scrapeEvent{
+		Previous: &scrapeRecord{Time: at.Add(-time.Hour), Tickers: []tickerRecord{
+			{Name: tickerName{Short: "SBER"}, Consensus: consensus(20), Forecasts: forecasts(5, 20)},
+			{Name: tickerName{Short: "GAZP"}, Consensus: consensus(10), Forecasts: forecasts(6, 10)},
+		}},
+		Current: &scrapeRecord{Time: at, Tickers: []tickerRecord{
+			{Name: tickerName{Short: "SBER"}, Consensus: consensus(26), Forecasts: append(forecasts(5, 20), forecast{ID: "new", ExpectedDiff: 60, Time: at})},
+			{Name: tickerName{Short: "GAZP"}, Forecasts: forecasts(4, 10)},
+		}},
+		Changes: []entities.ForecastChange{{Ticker: "SBER", Type: changeTypeNew, ForecastID: "new"}},
+	}
+
+	rules, err := parseAlertRules("SBER consensus crosses 25; GAZP consensus crosses 25; * forecasts crossesBelow 5; * deviation above 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := evaluateAlerts(rules, event)
+	want := map[string]string{
+		"SBER consensus crosses 25":  "SBER",
+		"* forecasts crossesBelow 5": "GAZP",
+		"* deviation above 30":       "SBER",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("evaluateAlerts() got %d alerts %+v, want %d", len(got), got, len(want))
+	}
+	for _, alert := range got {
+		if want[alert.Rule] != alert.Ticker {
+			t.Errorf("evaluateAlerts() got unexpected alert %+v", alert)
+		}
+	}
+}
+
+func Test_alertNotifier_fresh_suppresses_within_window(t *testing.T) {
+	notifier := newAlertNotifier()
+	at := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	if !notifier.fresh("key", at, time.Hour) {
+		t.Errorf("fresh() = false for the first alert, want true")
+	}
+	if notifier.fresh("key", at.Add(30*time.Minute), time.Hour) {
+		t.Errorf("fresh() = true within the window, want false")
+	}
+	if !notifier.fresh("key", at.Add(time.Hour), time.Hour) {
+		t.Errorf("fresh() = false after the window, want true")
+	}
+}
+
+func Test_deliverAlert_signs_and_retries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if got, want := r.Header.Get(webhookSignatureHeader), signWebhookBody("secret", body); got != want {
+			t.Errorf("deliverAlert() signature = %s, want %s", got, want)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	if err := deliverAlert(server.URL, "secret", entities.Alert{ID: "id"}, 2, time.Millisecond); err != nil {
+		t.Errorf("deliverAlert() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("deliverAlert() made %d calls, want 3", calls)
+	}
+
+	if err := deliverAlert(server.URL, "secret", entities.Alert{ID: "id"}, 0, time.Millisecond); err != nil {
+		t.Errorf("deliverAlert() error = %v", err)
+	}
+}
+
+func Test_deliverAlert_does_not_retry_rejected_alert(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		{name: "bad request", status: http.StatusBadRequest, wantCalls: 1},
+		{name: "not found", status: http.StatusNotFound, wantCalls: 1},
+		{name: "too many requests", status: http.StatusTooManyRequests, wantCalls: 3},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := deliverAlert(server.URL+"/services/secret", "", entities.Alert{ID: "id"}, 2, time.Millisecond)
+			if err == nil {
+				t.Errorf("deliverAlert() error = nil, want error")
+			} else if strings.Contains(err.Error(), "secret") {
+				t.Errorf("deliverAlert() error = %v reveals the webhook path", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("deliverAlert() made %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_deliverAlert_redacts_unreachable_webhook(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	err := deliverAlert(server.URL+"/services/secret", "", entities.Alert{ID: "id"}, 0, time.Millisecond)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("deliverAlert() error = %v, want error without the webhook path", err)
+	}
+}
+
+func Test_finishScrape_checks_alerts_of_every_scrape(t *testing.T) {
+	delivered := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- r.Header.Get(webhookAlertIDHeader)
+	}))
+	defer server.Close()
+
+	properties := validTestProperties(t)
+	properties.Alerts.Rules = "ALRT consensus crosses 25"
+	properties.Alerts.Webhooks = server.URL
+	propsMu.Lock()
+	saved, savedHistory, savedAlerts := props, history, alerts
+	props, history, alerts = properties, nil, newAlertNotifier()
+	propsMu.Unlock()
+	defer func() {
+		propsMu.Lock()
+		props, history, alerts = saved, savedHistory, savedAlerts
+		propsMu.Unlock()
+	}()
+
+	scrape := func(diff float64) {
+		var forecasts []forecast
+		for i := 0; i < 5; i++ {
+			forecasts = append(forecasts, forecast{ID: string(rune('a' + i)), ExpectedDiff: diff, Time: clock()})
+		}
+		finishScrape(context.Background(), &[]stockTicker{{Name: tickerName{Short: "ALRT"}, Forecasts: &forecasts}})
+	}
+
+	scrape(20)
+	scrape(30)
+
+	select {
+	case id := <-delivered:
+		if id == "" {
+			t.Errorf("finishScrape() delivered alert without ID")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("finishScrape() did not deliver the alert of consensus crossing")
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorAuthMissing = 1501
+	errorAuthInvalid = 1502
+	errorAuthScope   = 1503
+	errorRateLimited = 1504
+
+	// authDomain marks HTTPErrorDetails of rejected requests.
+	authDomain = "auth"
+
+	scopeRead    = "read"    // cached data: history, changes, stored consensus, jobs state
+	scopeRefresh = "refresh" // requests which trigger scraping of the upstream
+	scopeAdmin   = "admin"   // configuration
+)
+
+var (
+	apiKeys = &apiKeyRegistry{buckets: make(map[string]*tokenBucket)}
+
+	authRejections = metrics.counter("ticker_parser_auth_rejections_total",
+		"Rejected API requests by reason: missing, invalid, scope and rate.", "reason")
+)
+
+// apiKey is a client allowed to call the API. Rate is requests per minute, zero means no limit.
+type apiKey struct {
+	name   string
+	hash   string
+	scopes map[string]bool
+	rate   float64
+	burst  int
+}
+
+// parseAPIKeys parses keys separated by ';' or new lines. Every key looks like
+// "<name> <sha256 of the key> <scopes> [<rate>/<burst>]", for example:
+//
+//	dashboard 9f86d081884c7d65...  read                  default rate limit
+//	reports   60303ae22b998861...  read,refresh 6/2      6 requests per minute, 2 at once
+//
+// Scopes are read, refresh and admin separated by commas. The hash is a hex sha256 of the key, e.g.
+// printf %s "$KEY" | sha256sum. Keys without own limit get defaultRate and defaultBurst.
+func parseAPIKeys(raw string, defaultRate float64, defaultBurst int) ([]apiKey, error) {
+	var keys []apiKey
+	names := make(map[string]bool)
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("api key %q must have 3 or 4 fields: <name> <sha256> <scopes> [<rate>/<burst>]",
+				fields[0])
+		}
+
+		key := apiKey{name: fields[0], hash: strings.ToLower(fields[1]), scopes: make(map[string]bool),
+			rate: defaultRate, burst: defaultBurst}
+		if names[key.name] {
+			return nil, fmt.Errorf("api key %q is duplicated", key.name)
+		}
+		names[key.name] = true
+
+		if hash, err := hex.DecodeString(key.hash); err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("api key %q must have hex sha256 of the key", key.name)
+		}
+
+		for _, scope := range strings.Split(fields[2], ",") {
+			switch scope {
+			case scopeRead, scopeRefresh, scopeAdmin:
+				key.scopes[scope] = true
+			default:
+				return nil, fmt.Errorf("api key %q has unknown scope %q, expected %s, %s or %s",
+					key.name, scope, scopeRead, scopeRefresh, scopeAdmin)
+			}
+		}
+
+		if len(fields) == 4 {
+			parts := strings.SplitN(fields[3], "/", 2)
+			rate, err1 := strconv.ParseFloat(parts[0], 64)
+			var burst int
+			var err2 error
+			if len(parts) == 2 {
+				burst, err2 = strconv.Atoi(parts[1])
+			}
+			if len(parts) != 2 || err1 != nil || err2 != nil || rate < 0 || burst < 1 {
+				return nil, fmt.Errorf("api key %q has wrong limit %q, expected <requests per minute>/<burst>",
+					key.name, fields[3])
+			}
+			key.rate, key.burst = rate, burst
+		}
+
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenBucket allows burst requests at once and refills at rate tokens per minute.
+type tokenBucket struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token if there is one, otherwise returns the time to wait for it.
+func (ptr *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	if ptr.rate == 0 {
+		return true, 0
+	}
+	elapsed := now.Sub(ptr.last).Minutes()
+	ptr.tokens = math.Min(float64(ptr.burst), ptr.tokens+elapsed*ptr.rate)
+	ptr.last = now
+	if ptr.tokens >= 1 {
+		ptr.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - ptr.tokens) / ptr.rate * float64(time.Minute))
+	return false, wait
+}
+
+// apiKeyRegistry keeps keys parsed from the current properties and token buckets of the clients.
+// Buckets survive reloads unless limits of the key are changed.
+type apiKeyRegistry struct {
+	mu      sync.Mutex
+	raw     string
+	rate    float64
+	burst   int
+	keys    map[string]apiKey // by hash
+	buckets map[string]*tokenBucket
+}
+
+// lookup returns the key with the hash of given key according to the auth properties.
+func (ptr *apiKeyRegistry) lookup(properties *Properties, key string) (apiKey, bool) {
+	config := properties.Auth
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	if ptr.keys == nil || ptr.raw != config.Keys || ptr.rate != config.Rate || ptr.burst != int(config.Burst) {
+		keys, err := parseAPIKeys(config.Keys, config.Rate, int(config.Burst))
+		if err != nil {
+			// validation does not let such properties in, nobody is allowed just in case
+			serverLog.Errorf("cannot parse auth.keys: %s", err)
+		}
+		ptr.raw, ptr.rate, ptr.burst = config.Keys, config.Rate, int(config.Burst)
+		ptr.keys = make(map[string]apiKey)
+		for _, k := range keys {
+			ptr.keys[k.hash] = k
+		}
+	}
+
+	found, ok := ptr.keys[hashAPIKey(key)]
+	return found, ok
+}
+
+// allow takes a token from the bucket of the key.
+func (ptr *apiKeyRegistry) allow(key apiKey, now time.Time) (bool, time.Duration) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	bucket, ok := ptr.buckets[key.name]
+	if !ok || bucket.rate != key.rate || bucket.burst != key.burst {
+		bucket = &tokenBucket{rate: key.rate, burst: key.burst, tokens: float64(key.burst), last: now}
+		ptr.buckets[key.name] = bucket
+	}
+	return bucket.take(now)
+}
+
+// requestScope returns the scope required for the request.
+type requestScope func(r *http.Request) string
+
+func scopeOf(scope string) requestScope {
+	return func(*http.Request) string {
+		return scope
+	}
+}
+
+// tickerScope requires refresh for live tickers and read for stored ones.
+func tickerScope(r *http.Request) string {
+	if _, ok := tickerHistoryPath(r.URL.Path); ok || r.URL.Query().Get("asOf") != "" {
+		return scopeRead
+	}
+	return scopeRefresh
+}
+
+// jobScope requires read to watch jobs and refresh to start or cancel them.
+func jobScope(r *http.Request) string {
+	if r.Method == http.MethodGet {
+		return scopeRead
+	}
+	return scopeRefresh
+}
+
+// authRejection is the reason to reject a request by the auth. RetryAfter is set in seconds for
+// exceeded rate limits.
+type authRejection struct {
+	status     int
+	code       int
+	reason     string
+	message    string
+	location   string
+	help       string
+	retryAfter int
+}
+
+func (ptr *authRejection) httpError() *entities.HTTPError {
+	return entities.WrapErrors("request rejected", ptr.code, entities.HTTPErrorDetails{
+		Domain:       authDomain,
+		Reason:       ptr.reason,
+		Message:      ptr.message,
+		Location:     ptr.location,
+		LocationType: "header",
+		ExtendedHelp: ptr.help,
+	})
+}
+
+// authenticate finds the API key in the request headers by the auth properties.
+func authenticate(properties *Properties, requestHeader http.Header) (apiKey, *authRejection) {
+	header := properties.Auth.Header
+	raw := requestHeader.Get(header)
+	if raw == "" {
+		return apiKey{}, &authRejection{status: http.StatusUnauthorized, code: errorAuthMissing, reason: "missing",
+			message: "api key is required", location: header, help: "set the key in " + header + " header"}
+	}
+	key, ok := apiKeys.lookup(properties, raw)
+	if !ok {
+		return apiKey{}, &authRejection{status: http.StatusUnauthorized, code: errorAuthInvalid, reason: "invalid",
+			message: "api key is invalid", location: header, help: "check the key in " + header + " header"}
+	}
+	return key, nil
+}
+
+// permit checks that the key has the required scope and takes a token of its rate limit.
+func permit(properties *Properties, key apiKey, required string) *authRejection {
+	header := properties.Auth.Header
+	if !key.scopes[required] {
+		return &authRejection{status: http.StatusForbidden, code: errorAuthScope, reason: "scope",
+			message: fmt.Sprintf("api key %s has no %s scope", key.name, required), location: header,
+			help: "the request requires " + required + " scope"}
+	}
+
+	if allowed, wait := apiKeys.allow(key, time.Now()); !allowed {
+		seconds := int(math.Ceil(wait.Seconds()))
+		return &authRejection{status: http.StatusTooManyRequests, code: errorRateLimited, reason: "rate",
+			message: fmt.Sprintf("rate limit of api key %s is exceeded", key.name), location: header,
+			help: fmt.Sprintf("retry after %d seconds", seconds), retryAfter: seconds}
+	}
+	return nil
+}
+
+// authorize checks the API key of the request, its scope and rate limit if the auth is enabled.
+// The name of the key is added to the log fields of the request as client.
+func authorize(scope requestScope, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		properties := getProperties()
+		if !properties.Auth.Enabled {
+			handler(w, r)
+			return
+		}
+
+		key, rejection := authenticate(properties, r.Header)
+		if rejection == nil {
+			r = r.WithContext(withLogFields(r.Context(), log.Fields{"client": key.name}))
+			rejection = permit(properties, key, scope(r))
+		}
+		if rejection != nil {
+			rejectRequest(w, r, rejection)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func rejectRequest(w http.ResponseWriter, r *http.Request, rejection *authRejection) {
+	requestLogger(r).Warnf("request rejected: %s", rejection.message)
+	authRejections.add(1, rejection.reason)
+
+	if rejection.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(rejection.retryAfter))
+	}
+	writeHTTPResponse(w, rejection.status, entities.NewHTTPResponse(nil, rejection.httpError(), 1, r.URL.Path))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+func Test_parseAPIKeys(t *testing.T) {
+	hash := hashAPIKey("secret")
+	tests := []struct {
+		name      string
+		raw       string
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "empty", raw: ""},
+		{
+			name:      "keys",
+			raw:       "dashboard " + hash + " read;\nreports " + strings.ToUpper(hashAPIKey("other")) + " read,refresh 6/2",
+			wantNames: []string{"dashboard", "reports"},
+		},
+		{name: "short hash", raw: "dashboard abc read", wantErr: true},
+		{name: "unknown scope", raw: "dashboard " + hash + " write", wantErr: true},
+		{name: "wrong limit", raw: "dashboard " + hash + " read 6", wantErr: true},
+		{name: "duplicated name", raw: "a " + hash + " read; a " + hash + " admin", wantErr: true},
+		{name: "missing scopes", raw: "dashboard " + hash, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseAPIKeys(tt.raw, 60, 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAPIKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, key := range keys {
+				names = append(names, key.name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("parseAPIKeys() names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func Test_tokenBucket_take(t *testing.T) {
+	start := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	bucket := &tokenBucket{rate: 6, burst: 2, tokens: 2, last: start}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := bucket.take(start); !ok {
+			t.Fatalf("take() #%d rejected within burst", i)
+		}
+	}
+	ok, wait := bucket.take(start)
+	if ok || wait != 10*time.Second {
+		t.Errorf("take() = %v, %s after burst, want false, 10s", ok, wait)
+	}
+	if ok, _ := bucket.take(start.Add(10 * time.Second)); !ok {
+		t.Errorf("take() rejected after refill")
+	}
+}
+
+func Test_authorize(t *testing.T) {
+	properties := validTestProperties(t)
+	properties.Auth.Enabled = true
+	properties.Auth.Keys = "reader " + hashAPIKey("read-key") + " read 60/1"
+	propsMu.Lock()
+	saved := props
+	props = properties
+	propsMu.Unlock()
+	defer func() {
+		propsMu.Lock()
+		props = saved
+		propsMu.Unlock()
+	}()
+
+	handler := authorize(tickerScope, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		target     string
+		wantStatus int
+		wantCode   int
+	}{
+		{name: "missing key", target: "/ticker/?asOf=2020-03-20", wantStatus: http.StatusUnauthorized, wantCode: errorAuthMissing},
+		{name: "invalid key", key: "wrong", target: "/ticker/?asOf=2020-03-20", wantStatus: http.StatusUnauthorized, wantCode: errorAuthInvalid},
+		{name: "no refresh scope", key: "read-key", target: "/ticker/", wantStatus: http.StatusForbidden, wantCode: errorAuthScope},
+		{name: "allowed", key: "read-key", target: "/ticker/?asOf=2020-03-20", wantStatus: http.StatusOK},
+		{name: "rate limited", key: "read-key", target: "/ticker/?asOf=2020-03-20", wantStatus: http.StatusTooManyRequests, wantCode: errorRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.key != "" {
+				request.Header.Set("X-API-Key", tt.key)
+			}
+			recorder := httptest.NewRecorder()
+			handler(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("authorize() status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantCode == 0 {
+				return
+			}
+			var response entities.HTTPResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error == nil || response.Error.Code != tt.wantCode {
+				t.Errorf("authorize() error = %+v, want code %d", response.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+func Test_newServeMux(t *testing.T) {
+	properties := validTestProperties(t)
+	properties.Auth.Enabled = true
+	properties.Auth.Keys = "reader " + hashAPIKey("read-key") + " read"
+	propsMu.Lock()
+	saved := props
+	props = properties
+	propsMu.Unlock()
+	defer func() {
+		propsMu.Lock()
+		props = saved
+		propsMu.Unlock()
+	}()
+
+	mux := newServeMux()
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "expvar", target: "/debug/vars", wantStatus: http.StatusNotFound},
+		{name: "requests trace", target: "/debug/requests", wantStatus: http.StatusNotFound},
+		{name: "pprof", target: "/debug/pprof/", wantStatus: http.StatusNotFound},
+		{name: "root", target: "/", wantStatus: http.StatusNotFound},
+		{name: "api without key", target: statusHandlerPath, wantStatus: http.StatusUnauthorized},
+		{name: "health", target: healthzHandlerPath, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("GET %s = %d, want %d", tt.target, recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
 	"ticker-parser/app/entities"
+	"time"
 )
 
 const errorCatalogFetching = 1001
@@ -14,48 +17,154 @@ const errorCatalogFetching = 1001
 var (
 	catalogGetHandlerPath = "/catalog/fetch"
 
+	// catalogBaseUrl and catalogPageSize are replaced by setProperties, use catalogSettings to read them.
 	catalogBaseUrl  = getProperties().Parser.Catalog.BaseUrl
 	catalogPageSize = int(getProperties().Parser.Catalog.PageSize)
 )
 
+// catalogSettings returns catalog settings of the current properties.
+func catalogSettings() (string, int) {
+	propsMu.RLock()
+	defer propsMu.RUnlock()
+	return catalogBaseUrl, catalogPageSize
+}
+
+// catalogGetHandler serves the catalog in the response envelope, or streams it as NDJSON if the client
+// accepts application/x-ndjson.
 func catalogGetHandler(w http.ResponseWriter, r *http.Request) {
-	log.Infof("new request from %s: %s", r.RemoteAddr, r.URL.Path)
+	requestLogger(r).Info("new request")
+
+	if acceptsNDJSON(r) {
+		streamCatalog(w, r)
+		return
+	}
 
-	catalogHTTPData, httpError := catalogFetch()
+	catalogHTTPData, httpError := catalogFetch(r.Context())
 	if catalogHTTPData != nil {
-		log.Infof("%d items fetched", catalogHTTPData.ItemsCount)
+		logger(r.Context(), catalogLog).Infof("%d items fetched", catalogHTTPData.ItemsCount)
 	}
 
-	response := entities.NewHTTPResponse(catalogHTTPData, httpError, 1, r.URL.Path)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Errorf("cannot encode CatalogHTTPData: %s", err)
+	writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(catalogHTTPData, httpError, 1, r.URL.Path))
+}
+
+type catalogFetchResult struct {
+	data *entities.CatalogHTTPData
+	err  *entities.HTTPError
+}
+
+// catalogFetch fetches all catalog pages, concurrent calls share one execution. It returns as soon
+// as ctx is cancelled, the execution stops if no other caller waits for it.
+func catalogFetch(ctx context.Context) (*entities.CatalogHTTPData, *entities.HTTPError) {
+	result, err := flights.do(ctx, "catalogFetch", "catalogFetch", func(ctx context.Context) interface{} {
+		data, err := fetchCatalog(ctx, nil)
+		return catalogFetchResult{data: data, err: err}
+	})
+	if err != nil {
+		return nil, catalogCancelledError(err, 0)
 	}
+	return result.(catalogFetchResult).data, result.(catalogFetchResult).err
+}
+
+func catalogCancelledError(err error, page int) *entities.HTTPError {
+	return entities.WrapErrors("catalog fetching cancelled", errorCatalogFetching, entities.HTTPErrorDetails{
+		Reason:       err.Error(),
+		Message:      "catalog fetching cancelled",
+		Location:     strconv.Itoa(page),
+		LocationType: "page",
+	})
 }
 
-func catalogFetch() (*entities.CatalogHTTPData, *entities.HTTPError) {
+// fetchCatalog fetches catalog pages one by one until cancelled or the last page reached,
+// reports progress to given progress if it is not nil.
+func fetchCatalog(ctx context.Context, progress *scrapeProgress) (*entities.CatalogHTTPData, *entities.HTTPError) {
 	var items []entities.CatalogItem
+	_, httpError := fetchCatalogPages(ctx, progress, func(page []entities.CatalogItem) error {
+		items = append(items, page...)
+		return nil
+	})
+	if httpError != nil {
+		return nil, httpError
+	}
+	return entities.NewCatalogHTTPData(&items), nil
+}
+
+// fetchCatalogPages fetches catalog pages one by one and passes each of them to onPage until cancelled,
+// onPage fails or the last page reached. Returns the number of fetched pages.
+func fetchCatalogPages(ctx context.Context, progress *scrapeProgress,
+	onPage func(items []entities.CatalogItem) error) (pages int, httpError *entities.HTTPError) {
+	start := time.Now()
+	itemsByType := make(map[string]int)
+	defer func() {
+		if httpError != nil {
+			observeScrape("catalog", start, errors.New(httpError.Message))
+			return
+		}
+		observeScrape("catalog", start, nil)
+		catalogItems.reset()
+		for itemType, count := range itemsByType {
+			catalogItems.set(float64(count), itemType)
+		}
+	}()
+
+	// settings are taken once, so reload does not affect running fetching
+	baseUrl, pageSize := catalogSettings()
 
 	for i := 0; ; i++ {
-		newItems, errorDetails := catalogFetchPage(i)
+		if err := ctx.Err(); err != nil {
+			return i, catalogCancelledError(err, i)
+		}
+
+		progress.pageScheduled()
+		progress.addOngoing(1)
+		newItems, errorDetails := catalogFetchPage(withLogFields(ctx, log.Fields{"page": i}), baseUrl, pageSize, i)
+		progress.addOngoing(-1)
+		if err := ctx.Err(); err != nil {
+			return i, catalogCancelledError(err, i)
+		}
 		if errorDetails != nil {
-			errors := []entities.HTTPErrorDetails{*errorDetails}
-			return nil, entities.WrapErrors("cannot fetch catalog", errorCatalogFetching, errors...)
+			progress.addError(errors.New(errorDetails.Reason))
+			code := errorCatalogFetching
+			if errorDetails.Domain == upstreamUnavailableDomain {
+				code = errorUpstreamUnavailable
+			}
+			return i, entities.WrapErrors("cannot fetch catalog", code, *errorDetails)
+		}
+		progress.pageDone()
+		for _, item := range newItems {
+			itemsByType[item.Type]++
 		}
 
-		items = append(items, newItems...)
+		if err := onPage(newItems); err != nil {
+			return i + 1, entities.WrapErrors("catalog fetching stopped", errorCatalogFetching, entities.HTTPErrorDetails{
+				Reason:       err.Error(),
+				Message:      "catalog fetching stopped",
+				Location:     strconv.Itoa(i),
+				LocationType: "page",
+			})
+		}
 
-		if len(newItems) != catalogPageSize {
-			break
+		if len(newItems) != pageSize {
+			return i + 1, nil
 		}
 	}
-
-	return entities.NewCatalogHTTPData(&items), nil
 }
 
-func catalogFetchPage(page int) ([]entities.CatalogItem, *entities.HTTPErrorDetails) {
-	log.Debugf("getting page %d of catalog ...", page)
+func catalogFetchPage(ctx context.Context, baseUrl string, pageSize int,
+	page int) (items []entities.CatalogItem, details *entities.HTTPErrorDetails) {
+	ctx, span := startSpan(ctx, "catalogFetchPage", spanKindInternal)
+	span.setAttribute("catalog.page", page)
+	defer func() {
+		span.setAttribute("catalog.items", len(items))
+		if details != nil {
+			span.recordError(errors.New(details.Reason))
+		}
+		span.finish()
+	}()
+
+	entry := logger(ctx, catalogLog)
+	entry.Debugf("getting page %d of catalog ...", page)
 
-	url, err1 := getCatalogPageUrl(page)
+	url, err1 := catalogPageUrl(baseUrl, pageSize, page)
 	if err1 != nil {
 		return nil, &entities.HTTPErrorDetails{
 			Reason:       err1.Error(),
@@ -63,45 +172,77 @@ func catalogFetchPage(page int) ([]entities.CatalogItem, *entities.HTTPErrorDeta
 			Location:     strconv.Itoa(page),
 			LocationType: "page",
 			ExtendedHelp: "check your configuration parameter: parser.catalog.baseUrl\n" +
-				"current value: " + catalogBaseUrl,
+				"current value: " + redactString(redactURL, baseUrl),
 		}
 	}
 
-	response, err2 := getResponse(url)
+	entry = entry.WithField("url", url)
+	span.setAttribute("http.url", url)
+	limits := responseLimits{
+		limit:        getProperties().Parser.HTTP.Limits.Catalog,
+		parameter:    "parser.http.limits.catalog",
+		contentTypes: jsonContentTypes,
+	}
+	response, err2 := getResponse(ctx, url, limits)
+	if _, ok := err2.(*circuitOpenError); ok {
+		return nil, &entities.HTTPErrorDetails{
+			Domain:       upstreamUnavailableDomain,
+			Reason:       err2.Error(),
+			Message:      "catalog upstream is unavailable",
+			Location:     redactString(redactURL, url),
+			LocationType: "url",
+			ExtendedHelp: "check upstream state at " + statusHandlerPath,
+		}
+	}
+	if details := rejectedResponseDetails(err2); details != nil {
+		return nil, details
+	}
 	if err2 != nil {
 		return nil, &entities.HTTPErrorDetails{
 			Reason:       err2.Error(),
 			Message:      "cannot fetch catalog page",
-			Location:     url,
+			Location:     redactString(redactURL, url),
 			LocationType: "url",
 			ExtendedHelp: "check your configuration parameter: parser.catalog.baseUrl\n" +
-				"current value: " + catalogBaseUrl,
+				"current value: " + redactString(redactURL, baseUrl),
 		}
 	}
 	defer func() {
 		if err := response.Body.Close(); err != nil {
-			log.Error(fmt.Errorf("cannot close response from (%s) body: %w", url, err))
+			entry.Error(fmt.Errorf("cannot close response from (%s) body: %w", url, err))
 		}
 	}()
 
-	var items []entities.CatalogItem
-	if err3 := json.NewDecoder(response.Body).Decode(&items); err3 != nil {
+	if err3 := checkContentType(url, response, limits.contentTypes); err3 != nil {
+		return nil, rejectedResponseDetails(err3)
+	}
+
+	body := limitBody(url, response, limits.limit, limits.parameter)
+	if err4 := json.NewDecoder(body).Decode(&items); err4 != nil {
+		if details := rejectedResponseDetails(err4); details != nil {
+			return nil, details
+		}
 		return nil, &entities.HTTPErrorDetails{
-			Reason:       err3.Error(),
+			Reason:       err4.Error(),
 			Message:      "cannot parse catalog page",
-			Location:     url,
+			Location:     redactString(redactURL, url),
 			LocationType: "url",
 			ExtendedHelp: "check your configuration parameter: parser.catalog.baseUrl\n" +
-				"current value: " + catalogBaseUrl,
+				"current value: " + redactString(redactURL, baseUrl),
 		}
 	}
 
-	log.Debugf("got %d items from %s", len(items), url)
+	entry.Debugf("got %d items from %s", len(items), url)
 	return items, nil
 }
 
 func getCatalogPageUrl(page int) (string, error) {
-	req, err := http.NewRequest("GET", catalogBaseUrl, nil)
+	baseUrl, pageSize := catalogSettings()
+	return catalogPageUrl(baseUrl, pageSize, page)
+}
+
+func catalogPageUrl(baseUrl string, pageSize int, page int) (string, error) {
+	req, err := http.NewRequest("GET", baseUrl, nil)
 	if err != nil {
 		return "", err
 	}
@@ -109,8 +250,8 @@ func getCatalogPageUrl(page int) (string, error) {
 	q := req.URL.Query()
 	q.Add("sort", "leaders") // blue_chips, leaders, forecast (best forecasts)
 	q.Add("type", "share")   // share (stocks), bond, currency
-	q.Add("offset", strconv.Itoa(catalogPageSize*page))
-	q.Add("limit", strconv.Itoa(catalogPageSize))
+	q.Add("offset", strconv.Itoa(pageSize*page))
+	q.Add("limit", strconv.Itoa(pageSize))
 
 	req.URL.RawQuery = q.Encode()
 
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"ticker-parser/app/entities"
+)
+
+const ndjsonMediaType = "application/x-ndjson"
+
+// acceptsNDJSON reports if the Accept header of the request asks for NDJSON.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && mediaType == ndjsonMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// streamCatalog writes every CatalogItem as a JSON line as soon as its page is fetched and flushes
+// the response after every page. The last line is {"trailer": CatalogStreamTrailer} with totals and
+// the error if fetching failed. Fetching stops when the client goes away.
+func streamCatalog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ndjsonMediaType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	count := 0
+	pages, httpError := fetchCatalogPages(r.Context(), nil, func(items []entities.CatalogItem) error {
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+			count++
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	logger(r.Context(), catalogLog).Infof("%d items streamed from %d pages", count, pages)
+
+	trailer := entities.CatalogStreamTrailer{ItemsCount: count, PagesCount: pages, Error: httpError}
+	if err := encoder.Encode(map[string]interface{}{"trailer": trailer}); err != nil {
+		logger(r.Context(), catalogLog).Errorf("cannot encode catalog stream trailer: %s", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_catalogGetHandler_streams_ndjson(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("offset") == "0" {
+			_, _ = w.Write([]byte(`[{"title": "A"}, {"title": "B"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"title": "C"}]`))
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	backupClient, backupUrl, backupSize := upstream, catalogBaseUrl, catalogPageSize
+	defer func() {
+		upstream, catalogBaseUrl, catalogPageSize = backupClient, backupUrl, backupSize
+	}()
+	upstream, catalogBaseUrl, catalogPageSize = newTestUpstreamClient(t, &sleeps), server.URL, 2
+
+	request := httptest.NewRequest(http.MethodGet, catalogGetHandlerPath, nil)
+	request.Header.Set("Accept", "application/x-ndjson")
+	recorder := httptest.NewRecorder()
+	catalogGetHandler(recorder, request)
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("catalogGetHandler() wrote wrong line %s: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 4 || lines[2]["title"] != "C" {
+		t.Fatalf("catalogGetHandler() wrote %v, want 3 items and trailer", lines)
+	}
+	trailer, ok := lines[3]["trailer"].(map[string]interface{})
+	if !ok || trailer["itemsCount"] != 3.0 || trailer["pagesCount"] != 2.0 || trailer["error"] != nil {
+		t.Errorf("catalogGetHandler() trailer = %v, want 3 items of 2 pages without error", lines[3])
+	}
+	if !recorder.Flushed {
+		t.Errorf("catalogGetHandler() did not flush the response")
+	}
+}
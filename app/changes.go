@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	changeTypeNew       = "new"
+	changeTypeRevised   = "revised"
+	changeTypeWithdrawn = "withdrawn"
+
+	changeDirectionUp   = "up"
+	changeDirectionDown = "down"
+)
+
+var changesHandlerPath = "/changes"
+
+// detectChanges compares actual forecasts of two scrapes. A forecast with a known id and another target
+// is revised, a forecast replacing disappeared one of the same analyst is revised too. Forecasts which
+// disappeared or dropped out of the actual window are withdrawn. Tickers absent in the current scrape
+// are skipped, most likely they just failed to parse.
+func detectChanges(previous *scrapeRecord, current *scrapeRecord) []entities.ForecastChange {
+	if previous == nil {
+		return nil
+	}
+
+	previousTickers := make(map[string]tickerRecord)
+	for _, ticker := range previous.Tickers {
+		previousTickers[ticker.Name.Short] = ticker
+	}
+
+	var changes []entities.ForecastChange
+	for _, ticker := range current.Tickers {
+		previousTicker, ok := previousTickers[ticker.Name.Short]
+		if !ok {
+			continue
+		}
+
+		before := actualForecasts(previousTicker.Forecasts, previous.Time)
+		after := actualForecasts(ticker.Forecasts, current.Time)
+
+		beforeByID := make(map[string]forecast)
+		for _, forecast := range before {
+			beforeByID[forecast.ID] = forecast
+		}
+		afterByID := make(map[string]forecast)
+		for _, forecast := range after {
+			afterByID[forecast.ID] = forecast
+		}
+
+		replaced := make(map[string]bool)
+		for _, forecast := range after {
+			change := newForecastChange(current, ticker.Name.Short, forecast)
+
+			if old, ok := beforeByID[forecast.ID]; ok {
+				if old.Target == forecast.Target {
+					continue
+				}
+				markRevised(&change, old)
+			} else if old, ok := disappearedForecastOf(before, afterByID, replaced, forecast.Analyst); ok {
+				replaced[old.ID] = true
+				markRevised(&change, old)
+			} else {
+				change.Type = changeTypeNew
+			}
+			changes = append(changes, change)
+		}
+
+		for _, forecast := range before {
+			if _, ok := afterByID[forecast.ID]; ok || replaced[forecast.ID] {
+				continue
+			}
+			change := newForecastChange(current, ticker.Name.Short, forecast)
+			change.Type = changeTypeWithdrawn
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// actualForecasts returns forecasts which pass filterOldForecasts at given time.
+func actualForecasts(forecasts []forecast, at time.Time) []forecast {
+	var actual []forecast
+	for _, forecast := range forecasts {
+		if !forecast.Time.Before(at.AddDate(0, -forecastActualMonths, 0)) {
+			actual = append(actual, forecast)
+		}
+	}
+	return actual
+}
+
+// disappearedForecastOf finds the latest not yet replaced forecast of the analyst which is absent now.
+func disappearedForecastOf(before []forecast, after map[string]forecast, replaced map[string]bool, analyst string) (forecast, bool) {
+	var found forecast
+	ok := false
+	if analyst == "" {
+		return found, ok
+	}
+	for _, forecast := range before {
+		if _, exists := after[forecast.ID]; exists || replaced[forecast.ID] || forecast.Analyst != analyst {
+			continue
+		}
+		if !ok || forecast.Time.After(found.Time) {
+			found, ok = forecast, true
+		}
+	}
+	return found, ok
+}
+
+func newForecastChange(scrape *scrapeRecord, ticker string, forecast forecast) entities.ForecastChange {
+	return entities.ForecastChange{
+		ScrapeID:     scrape.ID,
+		Time:         scrape.Time,
+		Ticker:       ticker,
+		ForecastID:   forecast.ID,
+		Analyst:      forecast.Analyst,
+		ForecastTime: forecast.Time,
+		Target:       forecast.Target,
+	}
+}
+
+func markRevised(change *entities.ForecastChange, previous forecast) {
+	change.Type = changeTypeRevised
+	change.PreviousTarget = previous.Target
+	change.Direction = changeDirectionUp
+	if change.Target < previous.Target {
+		change.Direction = changeDirectionDown
+	}
+}
+
+// changesHandler serves GET /changes?since= with forecast changes detected since given time,
+// the last day by default.
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("new request")
+
+	if history == nil {
+		httpError := entities.WrapErrors("changes are unavailable", errorHistoryUnavailable, entities.HTTPErrorDetails{
+			Reason:       errHistoryDisabled.Error(),
+			Message:      "changes are unavailable",
+			Location:     "storage.enabled",
+			LocationType: "configuration",
+		})
+		writeHTTPResponse(w, http.StatusServiceUnavailable, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	since := clock().AddDate(0, 0, -1)
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		value, err := parseHistoryTime(raw)
+		if err != nil {
+			httpError := entities.WrapErrors("wrong changes request", errorHistoryRequest, historyParamError("since", err))
+			writeHTTPResponse(w, http.StatusBadRequest, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+			return
+		}
+		since = value
+	}
+
+	changes, err := history.Changes(since)
+	if err != nil {
+		historyLog.Error(err)
+		httpError := entities.WrapErrors("cannot read changes", errorHistoryReading, entities.HTTPErrorDetails{
+			Reason:       err.Error(),
+			Message:      "cannot read changes",
+			Location:     getProperties().Storage.Path,
+			LocationType: "file",
+		})
+		writeHTTPResponse(w, http.StatusInternalServerError, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	data := &entities.ChangesHTTPData{
+		Since:        since,
+		ChangesCount: len(changes),
+		Changes:      append([]entities.ForecastChange{}, changes...),
+	}
+	writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(data, nil, 1, r.URL.Path))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_detectChanges(t *testing.T) {
+	at := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	day := func(days int) time.Time {
+		return at.AddDate(0, 0, -days)
+	}
+	newForecast := func(analyst string, target float64, date time.Time) forecast {
+		return forecast{ID: forecastID("SBER", analyst, date), Analyst: analyst, Target: target, Time: date}
+	}
+
+	previous := &scrapeRecord{ID: 1, Time: at.AddDate(0, 0, -1), Tickers: []tickerRecord{
+		{Name: tickerName{Short: "SBER"}, Forecasts: []forecast{
+			newForecast("same", 100, day(5)),
+			newForecast("edited", 100, day(5)),
+			newForecast("republished", 100, day(10)),
+			newForecast("gone", 100, day(3)),
+			newForecast("aged", 100, day(30)),
+		}},
+		{Name: tickerName{Short: "GAZP"}, Forecasts: []forecast{
+			{ID: "gazp", Target: 100, Time: day(1)},
+		}},
+	}}
+	current := &scrapeRecord{ID: 2, Time: at, Tickers: []tickerRecord{
+		{Name: tickerName{Short: "SBER"}, Forecasts: []forecast{
+			newForecast("same", 100, day(5)),
+			newForecast("edited", 120, day(5)),
+			newForecast("republished", 90, day(0)),
+			newForecast("aged", 100, day(30)),
+			newForecast("fresh", 100, day(0)),
+		}},
+	}}
+
+	got := detectChanges(previous, current)
+
+	want := map[string]struct {
+		typ       string
+		direction string
+	}{
+		"edited":      {typ: changeTypeRevised, direction: changeDirectionUp},
+		"republished": {typ: changeTypeRevised, direction: changeDirectionDown},
+		"fresh":       {typ: changeTypeNew},
+		"gone":        {typ: changeTypeWithdrawn},
+		"aged":        {typ: changeTypeWithdrawn},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("detectChanges() got %d changes %+v, want %d", len(got), got, len(want))
+	}
+	for _, change := range got {
+		expected, ok := want[change.Analyst]
+		if !ok {
+			t.Errorf("detectChanges() got unexpected change %+v", change)
+			continue
+		}
+		if change.Type != expected.typ || change.Direction != expected.direction || change.ScrapeID != 2 {
+			t.Errorf("detectChanges() got %+v, want type %s direction %s", change, expected.typ, expected.direction)
+		}
+	}
+}
+
+func Test_detectChanges_without_previous_scrape(t *testing.T) {
+	if got := detectChanges(nil, &scrapeRecord{}); got != nil {
+		t.Errorf("detectChanges() = %v, want nil", got)
+	}
+}
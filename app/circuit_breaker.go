@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorUpstreamUnavailable = 1003
+
+	// upstreamUnavailableDomain marks HTTPErrorDetails caused by open circuit breaker.
+	upstreamUnavailableDomain = "upstream"
+
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "halfOpen"
+)
+
+var (
+	statusHandlerPath = "/status"
+
+	breakers = newBreakerRegistry()
+)
+
+// circuitOpenError is returned instead of requesting the host while its circuit breaker is open.
+type circuitOpenError struct {
+	Host    string
+	RetryAt time.Time
+}
+
+func (ptr *circuitOpenError) Error() string {
+	return fmt.Sprintf("upstream %s is unavailable, circuit breaker is open until %s",
+		ptr.Host, ptr.RetryAt.Format(time.RFC3339))
+}
+
+// circuitBreaker tracks consecutive failures of an upstream host. It opens after threshold failures,
+// fails fast during cooldown and lets one probe request through after it (half-open state). Successful
+// probe closes the breaker, failed one opens it again.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	host        string
+	state       string
+	failures    int
+	lastError   string
+	lastFailure time.Time
+	openedAt    time.Time
+}
+
+// allow returns circuitOpenError if the request must not be sent.
+func (ptr *circuitBreaker) allow(now time.Time, cooldown time.Duration) error {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	switch ptr.state {
+	case circuitOpen:
+		retryAt := ptr.openedAt.Add(cooldown)
+		if now.Before(retryAt) {
+			return &circuitOpenError{Host: ptr.host, RetryAt: retryAt}
+		}
+		upstreamLog.Infof("circuit breaker of %s is half-open, probing", ptr.host)
+		ptr.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// the probe is in flight, others wait for its result
+		return &circuitOpenError{Host: ptr.host, RetryAt: now.Add(cooldown)}
+	}
+	return nil
+}
+
+// record registers the result of the request, err is nil for successful ones.
+func (ptr *circuitBreaker) record(err error, now time.Time, threshold int) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	if err == nil {
+		if ptr.state != circuitClosed {
+			upstreamLog.Infof("circuit breaker of %s is closed", ptr.host)
+		}
+		ptr.state = circuitClosed
+		ptr.failures = 0
+		return
+	}
+
+	ptr.failures++
+	ptr.lastError = err.Error()
+	ptr.lastFailure = now
+	if ptr.state == circuitHalfOpen || (threshold > 0 && ptr.failures >= threshold) {
+		if ptr.state != circuitOpen {
+			upstreamLog.Warnf("circuit breaker of %s is open after %d consecutive failures: %s", ptr.host, ptr.failures, err)
+		}
+		ptr.state = circuitOpen
+		ptr.openedAt = now
+	}
+}
+
+// cancel releases the probe slot if the cancelled request was the probe, so the next request probes again.
+func (ptr *circuitBreaker) cancel() {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	if ptr.state == circuitHalfOpen {
+		ptr.state = circuitOpen
+	}
+}
+
+func (ptr *circuitBreaker) status(cooldown time.Duration) entities.UpstreamStatus {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	status := entities.UpstreamStatus{
+		Host:                ptr.host,
+		State:               ptr.state,
+		ConsecutiveFailures: ptr.failures,
+		LastError:           ptr.lastError,
+	}
+	if !ptr.lastFailure.IsZero() {
+		lastFailure := ptr.lastFailure
+		status.LastFailure = &lastFailure
+	}
+	if ptr.state != circuitClosed {
+		openedAt, retryAt := ptr.openedAt, ptr.openedAt.Add(cooldown)
+		status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+	}
+	return status
+}
+
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerRegistry() *breakerRegistry {
+	return &breakerRegistry{breakers: make(map[string]*circuitBreaker)}
+}
+
+// get returns the circuit breaker of the url host, creates it if needed.
+func (ptr *breakerRegistry) get(rawURL string) *circuitBreaker {
+	host := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	breaker, ok := ptr.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{host: host, state: circuitClosed}
+		ptr.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// states returns states of all known hosts sorted by host.
+func (ptr *breakerRegistry) states(cooldown time.Duration) []entities.UpstreamStatus {
+	ptr.mu.Lock()
+	var list []*circuitBreaker
+	for _, breaker := range ptr.breakers {
+		list = append(list, breaker)
+	}
+	ptr.mu.Unlock()
+
+	statuses := []entities.UpstreamStatus{}
+	for _, breaker := range list {
+		statuses = append(statuses, breaker.status(cooldown))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Host < statuses[j].Host
+	})
+	return statuses
+}
+
+// upstreamFailure returns the error if it means the host is unhealthy. Client errors like 404 and
+// responses rejected by the limits mean the host works fine.
+func upstreamFailure(err error) error {
+	if statusError, ok := err.(*httpStatusError); ok && !retryableStatus(statusError.StatusCode) {
+		return nil
+	}
+	if rejectedResponseDetails(err) != nil {
+		return nil
+	}
+	return err
+}
+
+// statusHandler serves GET /status with circuit breaker states of upstream hosts.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("new request")
+
+	cooldown := time.Duration(getProperties().Parser.HTTP.CircuitBreaker.Cooldown) * time.Second
+	data := &entities.StatusHTTPData{
+		Revision:  revision,
+		Upstreams: breakers.states(cooldown),
+	}
+	writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(data, nil, 1, r.URL.Path))
+}
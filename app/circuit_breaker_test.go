@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+func Test_circuitBreaker_opens_and_probes(t *testing.T) {
+	breaker := &circuitBreaker{host: "test", state: circuitClosed}
+	start := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	cooldown := time.Minute
+	failure := errors.New("failure")
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.allow(start, cooldown); err != nil {
+			t.Fatalf("allow() error = %v before threshold", err)
+		}
+		breaker.record(failure, start, 3)
+	}
+
+	err := breaker.allow(start.Add(time.Second), cooldown)
+	if _, ok := err.(*circuitOpenError); !ok {
+		t.Fatalf("allow() error = %v, want circuitOpenError", err)
+	}
+
+	if err := breaker.allow(start.Add(cooldown), cooldown); err != nil {
+		t.Fatalf("allow() error = %v, want probe after cooldown", err)
+	}
+	if err := breaker.allow(start.Add(cooldown), cooldown); err == nil {
+		t.Errorf("allow() let the second probe through")
+	}
+
+	breaker.record(failure, start.Add(cooldown), 3)
+	if breaker.state != circuitOpen {
+		t.Fatalf("breaker state = %s after failed probe, want %s", breaker.state, circuitOpen)
+	}
+
+	if err := breaker.allow(start.Add(2*cooldown), cooldown); err != nil {
+		t.Fatalf("allow() error = %v, want probe after cooldown", err)
+	}
+	breaker.record(nil, start.Add(2*cooldown), 3)
+	if breaker.state != circuitClosed || breaker.failures != 0 {
+		t.Errorf("breaker state = %s, failures = %d after successful probe, want closed", breaker.state, breaker.failures)
+	}
+}
+
+func Test_upstreamFailure_ignores_client_errors(t *testing.T) {
+	if err := upstreamFailure(&httpStatusError{StatusCode: 404}); err != nil {
+		t.Errorf("upstreamFailure() = %v for 404, want nil", err)
+	}
+	if err := upstreamFailure(&httpStatusError{StatusCode: 503}); err == nil {
+		t.Errorf("upstreamFailure() = nil for 503, want error")
+	}
+}
+
+func Test_handler_reports_open_circuit(t *testing.T) {
+	properties := validTestProperties(t)
+	var sleeps []time.Duration
+	propsMu.Lock()
+	saved := props
+	props = properties
+	propsMu.Unlock()
+	savedClient := upstream
+	upstream, breakers = newTestUpstreamClient(t, &sleeps), newBreakerRegistry()
+	upstream.breakerCooldown = time.Minute
+	defer func() {
+		upstream, breakers = savedClient, newBreakerRegistry()
+		propsMu.Lock()
+		props = saved
+		propsMu.Unlock()
+	}()
+	breakers.get(properties.Parser.URL).record(errors.New("failure"), time.Now(), 1)
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/ticker/", nil))
+
+	var response entities.HTTPResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("handler() wrote wrong body %s: %v", recorder.Body, err)
+	}
+	if recorder.Code != http.StatusServiceUnavailable || response.Error == nil ||
+		response.Error.Code != errorUpstreamUnavailable {
+		t.Errorf("handler() = %d %+v, want %d with code %d", recorder.Code, response.Error,
+			http.StatusServiceUnavailable, errorUpstreamUnavailable)
+	}
+}
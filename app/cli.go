@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Exit codes of the commands.
+const (
+	exitOK      = 0
+	exitFailure = 1 // nothing is done
+	exitUsage   = 2 // wrong arguments or configuration
+	exitPartial = 3 // some pages or files failed, the output has the rest
+)
+
+const defaultCommand = "serve"
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands = []command{
+	{name: "serve", description: "start the HTTP server (default)", run: serveCommand},
+	{name: "catalog", description: "fetch the catalog and write it to the output", run: catalogCommand},
+	{name: "scrape", description: "scrape tickers once and write them to the output", run: scrapeCommand},
+	{name: "parse", description: "parse saved HTML pages (or stdin) and write tickers to the output", run: parseCommand},
+}
+
+// printUsage prints the list of the commands.
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "\nUsage: ticker-parser [property flags] [command] [command flags]\n\nCommands:\n")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-8s %s\n", c.name, c.description)
+	}
+	_, _ = fmt.Fprintf(w, "\nRun ticker-parser <command> -h for the command flags.\n"+
+		"Exit codes: %d success, %d failure, %d usage or configuration error, %d partial success.\n",
+		exitOK, exitFailure, exitUsage, exitPartial)
+}
+
+// runCommand runs the command named by the first argument, serve if there are no arguments.
+func runCommand(args []string) int {
+	name := defaultCommand
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args)
+		}
+	}
+	log.Errorf("unknown command %s", name)
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+// outputFlags are flags of the commands which write tickers or catalog.
+type outputFlags struct {
+	format string
+	output string
+}
+
+func newCommandFlags(name string, output *outputFlags) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&output.format, "format", formatJSON, "output format: json, csv or table")
+	flags.StringVar(&output.output, "output", "-", "output file, - for stdout")
+	return flags
+}
+
+// parseCommandFlags parses the flags and checks the output format, returns exit code if the command
+// must stop.
+func parseCommandFlags(flags *flag.FlagSet, output *outputFlags, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	switch output.format {
+	case formatJSON, formatCSV, formatTable:
+	default:
+		log.Errorf("unknown output format %s, expected %s, %s or %s", output.format, formatJSON, formatCSV, formatTable)
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// checkProperties logs configuration problems and reports if there are none.
+func checkProperties() bool {
+	problems := validateProperties(getProperties())
+	for _, problem := range problems {
+		log.Error(problem)
+	}
+	if len(problems) != 0 {
+		log.Errorf("configuration has %d problems, fix them and start again", len(problems))
+	}
+	return len(problems) == 0
+}
+
+// writeOutput writes the value to the output file or stdout.
+func writeOutput(output *outputFlags, write func(w io.Writer) error) int {
+	w := io.Writer(os.Stdout)
+	if output.output != "-" {
+		file, err := os.Create(output.output)
+		if err != nil {
+			log.Errorf("cannot create output file: %s", err)
+			return exitFailure
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Errorf("cannot close output file: %s", err)
+			}
+		}()
+		w = file
+	}
+
+	if err := write(w); err != nil {
+		log.Errorf("cannot write output: %s", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func serveCommand(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if !checkProperties() {
+		return exitUsage
+	}
+	return serve()
+}
+
+func catalogCommand(args []string) int {
+	output := &outputFlags{}
+	if code, ok := parseCommandFlags(newCommandFlags("catalog", output), output, args); !ok {
+		return code
+	}
+	if !checkProperties() {
+		return exitUsage
+	}
+
+	data, httpError := fetchCatalog(context.Background(), nil)
+	if httpError != nil {
+		for _, details := range httpError.Errors {
+			log.Errorf("%s: %s (%s)", httpError.Message, details.Reason, details.Location)
+		}
+		return exitFailure
+	}
+	return writeOutput(output, func(w io.Writer) error {
+		return writeCatalog(w, output.format, data)
+	})
+}
+
+// scrapeCommand scrapes tickers once. Complete scrape is recorded to the history like scheduled ones,
+// partial one is written to the output only, so missing tickers are not reported as withdrawn. Alerts
+// and updates are left to the server: the command exits before they could be delivered.
+func scrapeCommand(args []string) int {
+	output := &outputFlags{}
+	if code, ok := parseCommandFlags(newCommandFlags("scrape", output), output, args); !ok {
+		return code
+	}
+	if !checkProperties() {
+		return exitUsage
+	}
+	if err := openHistory(); err != nil {
+		log.WithError(err).Error("cannot open history storage")
+		return exitFailure
+	}
+	if history != nil {
+		defer func() {
+			if err := history.Close(); err != nil {
+				log.Errorf("cannot close history storage: %s", err)
+			}
+		}()
+	}
+
+	tickers, errorz := parseOnline(context.Background(), nil)
+	for _, err := range errorz {
+		log.Error(err)
+	}
+
+	code := exitOK
+	var collection *tickerCollection
+	switch {
+	case len(errorz) == 0:
+		scrapeTime := clock()
+		collection = &tickerCollection{Tickers: filter(context.Background(), tickers, scrapeTime)}
+		recordScrape(scrapeTime, tickers, collection.Tickers)
+	case len(*tickers) == 0:
+		return exitFailure
+	default:
+		code = exitPartial
+		collection = &tickerCollection{Tickers: filter(context.Background(), tickers, clock())}
+	}
+
+	if writeCode := writeOutput(output, func(w io.Writer) error {
+		return writeTickers(w, output.format, collection)
+	}); writeCode != exitOK {
+		return writeCode
+	}
+	return code
+}
+
+// parseCommand parses HTML files given as arguments, stdin if there are no arguments.
+func parseCommand(args []string) int {
+	output := &outputFlags{}
+	flags := newCommandFlags("parse", output)
+	filterEnabled := flags.Bool("filter", true, "drop old and extreme forecasts and calculate consensus")
+	if code, ok := parseCommandFlags(flags, output, args); !ok {
+		return code
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var tickers []stockTicker
+	failed := 0
+	for _, file := range files {
+		var body []byte
+		var err error
+		if file == "-" {
+			body, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			body, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			log.Errorf("cannot read %s: %s", file, err)
+			failed++
+			continue
+		}
+
+		result := parsePage(context.Background(), file, body, "text/html")
+		for _, err := range result.errors {
+			log.Error(err)
+		}
+		if len(result.errors) != 0 {
+			failed++
+		}
+		tickers = append(tickers, result.tickers...)
+	}
+	if failed == len(files) {
+		return exitFailure
+	}
+
+	collection := &tickerCollection{Tickers: &tickers}
+	if *filterEnabled {
+		collection.Tickers = filter(context.Background(), &tickers, clock())
+	}
+	if code := writeOutput(output, func(w io.Writer) error {
+		return writeTickers(w, output.format, collection)
+	}); code != exitOK {
+		return code
+	}
+	if failed != 0 {
+		return exitPartial
+	}
+	return exitOK
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTickerPage = `<html><body>
+<div class="header__tool__name-full">Сбербанк</div><div class="header__tool__name-short">SBER</div>
+<div class="chart__info__sum">100,00 ₽</div>
+<div class="js-review">
+<div class="item__review__sum">110,00 ₽</div><div class="item__review__date_big">04 фев 2019, 12:02</div>
+</div>
+</body></html>`
+
+func Test_runCommand_exit_codes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	page := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(page, []byte(testTickerPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.csv")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "unknown command", args: []string{"unknown"}, want: exitUsage},
+		{name: "unknown format", args: []string{"parse", "--format", "xml", page}, want: exitUsage},
+		{name: "parse", args: []string{"parse", "--filter=false", "--format", "csv", "--output", output, page}, want: exitOK},
+		{name: "partial parse", args: []string{"parse", "--filter=false", "--output", output, page, filepath.Join(dir, "missing.html")}, want: exitPartial},
+		{name: "failed parse", args: []string{"parse", filepath.Join(dir, "missing.html")}, want: exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runCommand(tt.args); got != tt.want {
+				t.Errorf("runCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "SBER") {
+		t.Errorf("parse wrote %s, want SBER ticker", written)
+	}
+}
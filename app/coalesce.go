@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// flights coalesces concurrent identical scrapes: doTheJob, catalogFetch and single page scrapes.
+	flights = newFlightGroup()
+
+	flightExecutions = metrics.counter("ticker_parser_flight_executions_total",
+		"Executions of coalesced work by job.", "job")
+	flightCoalesced = metrics.counter("ticker_parser_flight_coalesced_total",
+		"Callers which joined an execution in flight instead of starting a new one by job.", "job")
+)
+
+// flightGroup shares one in-flight execution between all concurrent callers of the same key.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	result  interface{}
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// do executes fn unless an execution for the same key is already in flight, in this case it waits
+// for that execution and returns its result. job is a metrics label, key identifies the work itself.
+// The execution is not bound to the context of any caller: it runs until every waiting caller is
+// cancelled or the application stops. A cancelled caller gets the error of its context.
+func (ptr *flightGroup) do(ctx context.Context, job string, key string,
+	fn func(ctx context.Context) interface{}) (interface{}, error) {
+	ptr.mu.Lock()
+	call, ok := ptr.calls[key]
+	if ok {
+		call.waiters++
+		ptr.mu.Unlock()
+		flightCoalesced.add(1, job)
+	} else {
+		// the execution is logged and traced as a part of the call of the caller which started it
+		callCtx, cancel := context.WithCancel(withParentSpan(withLogFields(appContext, contextLogFields(ctx)), ctx))
+		call = &flightCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		ptr.calls[key] = call
+		ptr.mu.Unlock()
+		flightExecutions.add(1, job)
+
+		go func() {
+			defer cancel()
+			call.result = fn(callCtx)
+			ptr.forget(key, call)
+			close(call.done)
+		}()
+	}
+
+	select {
+	case <-call.done:
+		return call.result, nil
+	case <-ctx.Done():
+		ptr.leave(key, call)
+		return nil, ctx.Err()
+	}
+}
+
+// leave unregisters the cancelled caller, the execution is cancelled when nobody waits for it anymore.
+func (ptr *flightGroup) leave(key string, call *flightCall) {
+	ptr.mu.Lock()
+	call.waiters--
+	abandoned := call.waiters == 0
+	if abandoned {
+		// new callers must not join the cancelled execution, so it is forgotten under the same lock
+		ptr.remove(key, call)
+	}
+	ptr.mu.Unlock()
+
+	if abandoned {
+		call.cancel()
+	}
+}
+
+func (ptr *flightGroup) forget(key string, call *flightCall) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.remove(key, call)
+}
+
+// remove deletes the call of the key unless it has been replaced by a new one, must be called under the lock.
+func (ptr *flightGroup) remove(key string, call *flightCall) {
+	if ptr.calls[key] == call {
+		delete(ptr.calls, key)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_flightGroup_do_shares_execution(t *testing.T) {
+	const job = "Test_flightGroup_do_shares_execution"
+	group := newFlightGroup()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var executions int32
+
+	fn := func(context.Context) interface{} {
+		if atomic.AddInt32(&executions, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return 42
+	}
+
+	const callers = 3
+	results := make(chan interface{}, callers)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, _ := group.do(context.Background(), job, "key", fn)
+		results <- result
+	}()
+	<-started
+
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, _ := group.do(context.Background(), job, "key", fn)
+			results <- result
+		}()
+	}
+	for coalesced(job) < callers-1 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if executions != 1 {
+		t.Errorf("do() executions = %d, want 1", executions)
+	}
+	for result := range results {
+		if result != 42 {
+			t.Errorf("do() result = %v, want 42", result)
+		}
+	}
+}
+
+func Test_flightGroup_do_runs_again_after_finish(t *testing.T) {
+	group := newFlightGroup()
+	executions := 0
+	fn := func(context.Context) interface{} {
+		executions++
+		return executions
+	}
+
+	if got, _ := group.do(context.Background(), "test", "key", fn); got != 1 {
+		t.Errorf("do() got = %v, want 1", got)
+	}
+	if got, _ := group.do(context.Background(), "test", "key", fn); got != 2 {
+		t.Errorf("do() got = %v, want 2", got)
+	}
+}
+
+func Test_flightGroup_do_cancels_abandoned_execution(t *testing.T) {
+	group := newFlightGroup()
+	started, stopped := make(chan struct{}), make(chan struct{})
+	fn := func(ctx context.Context) interface{} {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := group.do(ctx, "test", "key", fn)
+		errs <- err
+	}()
+	<-started
+	cancel()
+
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("do() error = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("do() did not cancel the execution without waiting callers")
+	}
+
+	got, err := group.do(context.Background(), "test", "key", func(context.Context) interface{} { return 1 })
+	if err != nil || got != 1 {
+		t.Errorf("do() after cancellation got = %v, %v, want 1 from the new execution", got, err)
+	}
+}
+
+func coalesced(job string) int {
+	flightCoalesced.mu.Lock()
+	defer flightCoalesced.mu.Unlock()
+	if series, ok := flightCoalesced.series[job]; ok {
+		return int(series.value)
+	}
+	return 0
+}
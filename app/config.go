@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/artemkaxboy/configuration"
+	"github.com/artemkaxboy/go-hocon"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultConfigFile = "ticker-parser.conf"
+
+	// configEnvPrefix starts names of environment variables overriding properties.
+	configEnvPrefix = "TICKER_PARSER_"
+	configFileEnv   = configEnvPrefix + "CONFIG"
+	configFileFlag  = "config"
+
+	originDefault = "default"
+	originFile    = "file"
+	originEnv     = "env"
+	originFlag    = "flag"
+)
+
+// propertyOrigin tells where the value of a property comes from. Source is the file path, the variable
+// or the flag name.
+type propertyOrigin struct {
+	origin string
+	source string
+}
+
+// property is a leaf of Properties addressed by its path in the configuration file. Redact is the value
+// of the redact tag, see redactProperty.
+type property struct {
+	path   string
+	env    string
+	redact string
+	value  reflect.Value
+}
+
+// listProperties returns all leaves of the properties in declaration order. Paths are built the same way
+// go-hocon builds them: node tag value if it is set, the field name otherwise.
+func listProperties(properties *Properties) []property {
+	var result []property
+	var walk func(parent string, value reflect.Value)
+	walk = func(parent string, value reflect.Value) {
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			path := field.Name
+			for _, option := range strings.Split(field.Tag.Get("hocon"), ",") {
+				if strings.HasPrefix(option, "node=") {
+					path = strings.TrimPrefix(option, "node=")
+				}
+			}
+			if parent != "" {
+				path = parent + "." + path
+			}
+
+			if field.Type.Kind() == reflect.Struct {
+				walk(path, value.Field(i))
+				continue
+			}
+			result = append(result, property{
+				path:   path,
+				env:    propertyEnv(path),
+				redact: field.Tag.Get("redact"),
+				value:  value.Field(i),
+			})
+		}
+	}
+	walk("", reflect.ValueOf(properties).Elem())
+	return result
+}
+
+// propertyEnv returns the environment variable name of the property path, for example
+// parser.catalog.baseUrl is overridden by TICKER_PARSER_PARSER_CATALOG_BASE_URL.
+func propertyEnv(path string) string {
+	var builder strings.Builder
+	builder.WriteString(configEnvPrefix)
+	var previous rune
+	for _, r := range path {
+		switch {
+		case r == '.':
+			builder.WriteRune('_')
+		case unicode.IsUpper(r) && (unicode.IsLower(previous) || unicode.IsDigit(previous)):
+			builder.WriteRune('_')
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(unicode.ToUpper(r))
+		}
+		previous = r
+	}
+	return builder.String()
+}
+
+// set parses the raw value according to the property type and stores it.
+func (ptr *property) set(raw string) error {
+	switch ptr.value.Kind() {
+	case reflect.String:
+		ptr.value.SetString(raw)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		ptr.value.SetBool(value)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, ptr.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		ptr.value.SetInt(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(raw, ptr.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		ptr.value.SetFloat(value)
+	default:
+		return fmt.Errorf("unsupported property type %s", ptr.value.Type())
+	}
+	return nil
+}
+
+// propertyFlag keeps the raw value of a command line flag until the configuration file is loaded.
+type propertyFlag struct {
+	raw    string
+	isBool bool
+}
+
+func (ptr *propertyFlag) String() string {
+	if ptr == nil {
+		return ""
+	}
+	return ptr.raw
+}
+
+func (ptr *propertyFlag) Set(raw string) error {
+	ptr.raw = raw
+	return nil
+}
+
+func (ptr *propertyFlag) IsBoolFlag() bool {
+	return ptr.isBool
+}
+
+// loadedProperties is the result of loadProperties.
+type loadedProperties struct {
+	properties *Properties
+	origins    map[string]propertyOrigin // by property path
+	file       string                    // configuration file path, it may not exist if it is the default one
+	args       []string                  // arguments left after the flags
+}
+
+// loadProperties builds Properties from the sources below, every next one overrides the previous:
+//
+//  1. defaults of the Properties struct tags
+//  2. configuration file: --config flag, TICKER_PARSER_CONFIG variable or ticker-parser.conf
+//  3. environment variables: TICKER_PARSER_ and the upper snake case property path,
+//     e.g. TICKER_PARSER_SERVER_PORT for server.port
+//  4. command line flags named by the property path, e.g. --server.port=8081
+//
+// The missing default configuration file is not an error, the file given explicitly must exist.
+func loadProperties(args []string, environ []string) (*loadedProperties, error) {
+	properties := &Properties{}
+	list := listProperties(properties)
+
+	flags := flag.NewFlagSet("ticker-parser", flag.ContinueOnError)
+	configFile := flags.String(configFileFlag, "", fmt.Sprintf("configuration file path, env %s (default %s)",
+		configFileEnv, defaultConfigFile))
+	values := make(map[string]*propertyFlag)
+	for _, p := range list {
+		values[p.path] = &propertyFlag{isBool: p.value.Kind() == reflect.Bool}
+		flags.Var(values[p.path], p.path, "overrides "+p.path+", env "+p.env)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	for _, variable := range environ {
+		if parts := strings.SplitN(variable, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	path, explicit := *configFile, true
+	if path == "" {
+		path = env[configFileEnv]
+	}
+	if path == "" {
+		path, explicit = defaultConfigFile, false
+	}
+	origins := make(map[string]propertyOrigin)
+	for _, p := range list {
+		origins[p.path] = propertyOrigin{origin: originDefault}
+	}
+
+	text, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		configLog.Warnf("configuration file %s not found, defaults are used", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read configuration file %s: %w", path, err)
+	}
+	if err := hocon.LoadConfigText(string(text), properties); err != nil {
+		return nil, fmt.Errorf("cannot load configuration file %s: %w", path, err)
+	}
+	if len(text) != 0 {
+		config := configuration.ParseString(string(text))
+		for _, p := range list {
+			if config.HasPath(p.path) {
+				origins[p.path] = propertyOrigin{origin: originFile, source: path}
+			}
+		}
+	}
+
+	for i := range list {
+		if raw, ok := env[list[i].env]; ok {
+			if err := list[i].set(raw); err != nil {
+				return nil, fmt.Errorf("wrong value of environment variable %s: %w", list[i].env, err)
+			}
+			origins[list[i].path] = propertyOrigin{origin: originEnv, source: list[i].env}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for i := range list {
+			if list[i].path == f.Name && flagErr == nil {
+				if err := list[i].set(values[f.Name].raw); err != nil {
+					flagErr = fmt.Errorf("wrong value of flag --%s: %w", f.Name, err)
+				}
+				origins[f.Name] = propertyOrigin{origin: originFlag, source: "--" + f.Name}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	return &loadedProperties{properties: properties, origins: origins, file: path, args: flags.Args()}, nil
+}
+
+// initProperties loads properties with the command line arguments and applies them,
+// returns arguments left after the flags.
+func initProperties(args []string) ([]string, error) {
+	loaded, err := loadProperties(args, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	propertiesArgs = args
+	propertiesFile = loaded.file
+	setProperties(loaded.properties, loaded.origins)
+	return loaded.args, nil
+}
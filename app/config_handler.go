@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"ticker-parser/app/entities"
+)
+
+const (
+	redactedValue = "[redacted]"
+
+	// values of redact tag of Properties fields
+	redactSecret  = "secret"  // the whole value is hidden
+	redactURL     = "url"     // the password of URL user info is hidden
+	redactHeaders = "headers" // values of credential headers are hidden
+	redactURLs    = "urls"    // comma separated URLs, user info, path and query of every URL are hidden
+)
+
+var (
+	configHandlerPath = "/config"
+
+	sensitiveHeaderParts = []string{"auth", "cookie", "token", "key", "secret", "password"}
+)
+
+// redactProperty returns the value of the property safe to show.
+func redactProperty(p property) interface{} {
+	value := p.value.Interface()
+	raw, ok := value.(string)
+	if !ok || raw == "" {
+		return value
+	}
+	return redactString(p.redact, raw)
+}
+
+// redactString hides sensitive parts of the value according to given value of redact tag.
+func redactString(redact string, raw string) string {
+	switch redact {
+	case redactSecret:
+		return redactedValue
+	case redactURL:
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return redactedValue
+		}
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			parsed.User = url.UserPassword(parsed.User.Username(), "xxxxx")
+		}
+		return parsed.String()
+	case redactURLs:
+		urls := strings.Split(raw, ",")
+		for i, raw := range urls {
+			parsed, err := url.Parse(strings.TrimSpace(raw))
+			if err != nil {
+				urls[i] = redactedValue
+				continue
+			}
+			if parsed.User != nil {
+				parsed.User = url.User("xxxxx")
+			}
+			// webhooks like Slack ones keep the secret in the path
+			if parsed.Path != "" && parsed.Path != "/" {
+				parsed.Path, parsed.RawPath = "/xxxxx", ""
+			}
+			if parsed.RawQuery != "" {
+				parsed.RawQuery = "xxxxx"
+			}
+			urls[i] = parsed.String()
+		}
+		return strings.Join(urls, ",")
+	case redactHeaders:
+		lines := strings.Split(raw, "\n")
+		for i, line := range lines {
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) == 2 && sensitiveHeader(parts[0]) {
+				lines[i] = parts[0] + ": " + redactedValue
+			} else if len(parts) != 2 && strings.TrimSpace(line) != "" {
+				// a malformed line may be a header with a secret and a missing colon
+				lines[i] = redactedValue
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return raw
+}
+
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveHeaderParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveConfig lists all properties with their values and origins in declaration order.
+func effectiveConfig(properties *Properties, origins map[string]propertyOrigin, file string) *entities.ConfigHTTPData {
+	data := &entities.ConfigHTTPData{File: file, Properties: []entities.ConfigProperty{}}
+	for _, p := range listProperties(properties) {
+		origin, ok := origins[p.path]
+		if !ok {
+			origin = propertyOrigin{origin: originDefault}
+		}
+		value := redactProperty(p)
+		data.Properties = append(data.Properties, entities.ConfigProperty{
+			Path:     p.path,
+			Value:    value,
+			Origin:   origin.origin,
+			Source:   origin.source,
+			Env:      p.env,
+			Redacted: value != p.value.Interface(),
+		})
+	}
+	return data
+}
+
+// configHandler serves GET /config with the effective configuration, secrets are redacted.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("new request")
+
+	// the properties are copied, so listing does not race with reload
+	properties := *getProperties()
+	data := effectiveConfig(&properties, getPropertyOrigins(), propertiesFile)
+	writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(data, nil, 1, r.URL.Path))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// propertiesArgs and propertiesFile are the command line arguments and the configuration file
+	// the properties are loaded from, reload uses them again.
+	propertiesArgs []string
+	propertiesFile string
+
+	// reloadError is empty unless the last reload failed, readiness fails until a reload succeeds.
+	reloadError   string
+	reloadErrorMu sync.Mutex
+)
+
+// lastReloadError returns the error of the last reload, empty string if it succeeded.
+func lastReloadError() string {
+	reloadErrorMu.Lock()
+	defer reloadErrorMu.Unlock()
+	return reloadError
+}
+
+func setLastReloadError(err string) {
+	reloadErrorMu.Lock()
+	reloadError = err
+	reloadErrorMu.Unlock()
+}
+
+// setProperties replaces the current properties and origins of their values and propagates them to
+// the state copied from them: catalog settings, loggers and the upstream client which is recreated
+// on the next request.
+func setProperties(properties *Properties, origins map[string]propertyOrigin) {
+	propsMu.Lock()
+	previous := props
+	props = properties
+	propsOrigins = origins
+	catalogBaseUrl = properties.Parser.Catalog.BaseUrl
+	catalogPageSize = int(properties.Parser.Catalog.PageSize)
+	propsMu.Unlock()
+
+	upstreamMu.Lock()
+	upstream = nil
+	upstreamMu.Unlock()
+
+	configureLogging(properties)
+	if tracingServed && (previous == nil || previous.Tracing != properties.Tracing) {
+		configureTracing(properties)
+	}
+
+	if previous != nil {
+		if previous.Server.Port != properties.Server.Port {
+			configLog.Warnf("server.port change to %d is applied after restart only", properties.Server.Port)
+		}
+		if previous.GRPC != properties.GRPC {
+			configLog.Warn("grpc changes are applied after restart only")
+		}
+		if previous.Storage != properties.Storage {
+			configLog.Warn("storage changes are applied after restart only")
+		}
+	}
+}
+
+// reloadProperties loads and validates properties from the same sources as on start and replaces
+// the current ones. The current properties are kept if the new ones cannot be loaded or are invalid.
+func reloadProperties(reason string) error {
+	loaded, err := loadProperties(propertiesArgs, os.Environ())
+	if err == nil {
+		if problems := validateProperties(loaded.properties); len(problems) != 0 {
+			err = fmt.Errorf("configuration has %d problems: %v", len(problems), problems)
+		}
+	}
+	if err != nil {
+		configReloadsTotal.add(1, "failure")
+		setLastReloadError(err.Error())
+		configLog.Errorf("cannot reload configuration on %s, previous configuration is kept: %s", reason, err)
+		return err
+	}
+
+	setProperties(loaded.properties, loaded.origins)
+	configReloadsTotal.add(1, "success")
+	setLastReloadError("")
+	configLog.Infof("configuration reloaded on %s", reason)
+	return nil
+}
+
+// watchConfig reloads properties on SIGHUP and when the configuration file changes. Modification time
+// and size of the file are checked every config.watchInterval seconds. It never returns, so it must be
+// run in a goroutine.
+func watchConfig() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	version := fileVersion(propertiesFile)
+	for {
+		var tick <-chan time.Time
+		if interval := getProperties().Config.WatchInterval; interval > 0 {
+			tick = time.After(time.Duration(interval) * time.Second)
+		}
+
+		select {
+		case <-signals:
+			_ = reloadProperties("SIGHUP")
+			version = fileVersion(propertiesFile)
+		case <-tick:
+			if current := fileVersion(propertiesFile); current != version {
+				version = current
+				_ = reloadProperties("change of " + propertiesFile)
+			}
+		}
+	}
+}
+
+// fileVersion returns modification time and size of the file, empty string if it does not exist.
+func fileVersion(file string) string {
+	info, err := os.Stat(file)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func Test_reloadProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := getProperties()
+	previousOrigins := getPropertyOrigins()
+	defer func() {
+		_ = os.RemoveAll(dir)
+		propertiesArgs, propertiesFile = nil, ""
+		setProperties(previous, previousOrigins)
+	}()
+
+	file := filepath.Join(dir, "test.conf")
+	write := func(baseUrl string, pageSize int) {
+		conf := "parser.url = \"https://example.com\"\nparser.catalog.baseUrl = \"" + baseUrl + "\"\n" +
+			"parser.catalog.pageSize = " + strconv.Itoa(pageSize) + "\n"
+		if err := ioutil.WriteFile(file, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("https://first.com", 5)
+	if _, err := initProperties([]string{"--config", file}); err != nil {
+		t.Fatal(err)
+	}
+
+	write("https://second.com", 7)
+	if err := reloadProperties("test"); err != nil {
+		t.Fatalf("reloadProperties() error = %v", err)
+	}
+	if baseUrl, pageSize := catalogSettings(); baseUrl != "https://second.com" || pageSize != 7 {
+		t.Errorf("catalogSettings() = %s, %d after reload, want https://second.com, 7", baseUrl, pageSize)
+	}
+
+	write("www", 0)
+	if err := reloadProperties("test"); err == nil {
+		t.Errorf("reloadProperties() accepted invalid configuration")
+	}
+	if baseUrl, pageSize := catalogSettings(); baseUrl != "https://second.com" || pageSize != 7 {
+		t.Errorf("catalogSettings() = %s, %d after failed reload, want previous values", baseUrl, pageSize)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_propertyEnv(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "server.port", want: "TICKER_PARSER_SERVER_PORT"},
+		{path: "parser.catalog.baseUrl", want: "TICKER_PARSER_PARSER_CATALOG_BASE_URL"},
+		{path: "Filters.ExtremeValues.Enabled", want: "TICKER_PARSER_FILTERS_EXTREME_VALUES_ENABLED"},
+		{path: "jobs.TTL", want: "TICKER_PARSER_JOBS_TTL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := propertyEnv(tt.path); got != tt.want {
+				t.Errorf("propertyEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadProperties_precedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "test.conf")
+	conf := "server.port = 1000\nparser.url = \"http://file\"\nparser.catalog.pageSize = 10\nFilters.ExtremeValues.Threshold = 7\n"
+	if err := ioutil.WriteFile(file, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	environ := []string{
+		"TICKER_PARSER_SERVER_PORT=2000",
+		"TICKER_PARSER_PARSER_URL=http://env",
+		"TICKER_PARSER_DEBUG=true",
+	}
+	args := []string{"--config", file, "--server.port=3000", "--scheduler.enabled", "serve"}
+
+	loaded, err := loadProperties(args, environ)
+	if err != nil {
+		t.Fatalf("loadProperties() error = %v", err)
+	}
+	properties, rest := loaded.properties, loaded.args
+
+	if properties.Server.Port != 3000 {
+		t.Errorf("server.port = %d, want flag value 3000", properties.Server.Port)
+	}
+	if properties.Parser.URL != "http://env" || !properties.Debug {
+		t.Errorf("parser.url = %s, debug = %v, want environment values", properties.Parser.URL, properties.Debug)
+	}
+	if properties.Parser.Catalog.PageSize != 10 || properties.Filters.ExtremeValues.Threshold != 7 {
+		t.Errorf("pageSize = %d, threshold = %f, want file values", properties.Parser.Catalog.PageSize,
+			properties.Filters.ExtremeValues.Threshold)
+	}
+	if properties.Jobs.TTL != 3600 || !properties.Scheduler.Enabled {
+		t.Errorf("jobs.ttl = %d, scheduler.enabled = %v, want default and flag values", properties.Jobs.TTL,
+			properties.Scheduler.Enabled)
+	}
+	if loaded.file != file {
+		t.Errorf("loadProperties() file = %s, want %s", loaded.file, file)
+	}
+	if len(rest) != 1 || rest[0] != "serve" {
+		t.Errorf("loadProperties() rest = %v, want [serve]", rest)
+	}
+}
+
+func Test_loadProperties_fails(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		environ []string
+	}{
+		{name: "missing explicit file", args: []string{"--config", "/nonexistent/ticker-parser.conf"}},
+		{name: "missing file from environment", environ: []string{"TICKER_PARSER_CONFIG=/nonexistent.conf"}},
+		{name: "wrong environment value", environ: []string{"TICKER_PARSER_SERVER_PORT=port"}},
+		{name: "wrong flag value", args: []string{"--parser.catalog.pageSize=100000"}},
+		{name: "unknown flag", args: []string{"--unknown=1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadProperties(tt.args, tt.environ); err == nil {
+				t.Errorf("loadProperties() error = %v, wantErr %v", err, true)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"github.com/artemkaxboy/go-hocon"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"ticker-parser/app/entities"
+)
+
+const errorConfigInvalid = 1301
+
+var configValidateHandlerPath = "/config/validate"
+
+// configProblem is a wrong value of a property found by validateProperties.
+type configProblem struct {
+	path    string
+	value   interface{}
+	message string
+}
+
+func (ptr configProblem) String() string {
+	return fmt.Sprintf("%s = %v: %s", ptr.path, ptr.value, ptr.message)
+}
+
+// configValidator collects problems of the properties.
+type configValidator struct {
+	problems []configProblem
+}
+
+func (ptr *configValidator) check(ok bool, path string, value interface{}, message string) {
+	if !ok {
+		ptr.problems = append(ptr.problems, configProblem{path: path, value: value, message: message})
+	}
+}
+
+// checkURL reports the URL with hidden user info, path and query, they may keep credentials.
+func (ptr *configValidator) checkURL(path string, value string) {
+	parsed, err := url.Parse(value)
+	ptr.check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "",
+		path, redactString(redactURLs, value), "must be absolute http or https URL, e.g. https://example.com/path")
+}
+
+// validateProperties checks the whole configuration and returns all found problems, nil means it is valid.
+func validateProperties(properties *Properties) []configProblem {
+	v := &configValidator{}
+
+	v.check(properties.Log.Format == logFormatText || properties.Log.Format == logFormatJSON, "log.format",
+		properties.Log.Format, "must be text or json")
+	if _, err := log.ParseLevel(properties.Log.Level); err != nil {
+		v.check(false, "log.level", properties.Log.Level, "must be trace, debug, info, warn, error, fatal or panic")
+	}
+	if _, err := parseLogLevels(properties.Log.Levels); err != nil {
+		v.check(false, "log.levels", properties.Log.Levels, err.Error())
+	}
+	if tracing := properties.Tracing; tracing.Endpoint != "" {
+		v.checkURL("tracing.endpoint", tracing.Endpoint)
+	}
+	if _, err := parseHeaders(properties.Tracing.Headers); err != nil {
+		v.check(false, "tracing.headers", redactString(redactHeaders, properties.Tracing.Headers), err.Error())
+	}
+	auth := properties.Auth
+	v.check(!auth.Enabled || auth.Header != "", "auth.header", auth.Header, "is required while the auth is enabled")
+	v.check(auth.Rate >= 0, "auth.rate", auth.Rate, "must not be negative, 0 means no limit")
+	v.check(auth.Burst > 0, "auth.burst", auth.Burst, "must be positive")
+	if _, err := parseAPIKeys(auth.Keys, auth.Rate, int(auth.Burst)); err != nil {
+		v.check(false, "auth.keys", redactedValue, err.Error())
+	}
+	v.check(properties.Config.WatchInterval >= 0, "config.watchInterval", properties.Config.WatchInterval,
+		"must not be negative, 0 disables watching")
+	v.check(properties.Server.Port > 0 && properties.Server.Port <= 65535, "server.port", properties.Server.Port,
+		"must be between 1 and 65535")
+	if grpc := properties.GRPC; grpc.Enabled {
+		v.check(grpc.Port > 0 && grpc.Port <= 65535, "grpc.port", grpc.Port, "must be between 1 and 65535")
+		v.check(grpc.Port != properties.Server.Port, "grpc.port", grpc.Port, "must differ from server.port")
+	}
+	v.check(properties.Stream.Replay >= 0, "stream.replay", properties.Stream.Replay,
+		"must not be negative, 0 disables resuming")
+	v.check(properties.Stream.Heartbeat > 0, "stream.heartbeat", properties.Stream.Heartbeat, "must be positive")
+	v.check(properties.Server.ShutdownTimeout >= 0, "server.shutdownTimeout", properties.Server.ShutdownTimeout,
+		"must not be negative")
+
+	v.check(properties.Filters.ExtremeValues.Threshold >= 0, "Filters.ExtremeValues.Threshold",
+		properties.Filters.ExtremeValues.Threshold, "must not be negative")
+
+	alerts := properties.Alerts
+	if _, err := parseAlertRules(alerts.Rules); err != nil {
+		v.check(false, "Alerts.Rules", alerts.Rules, err.Error())
+	}
+	for _, webhook := range strings.Split(alerts.Webhooks, ",") {
+		if webhook = strings.TrimSpace(webhook); webhook != "" {
+			v.checkURL("Alerts.Webhooks", webhook)
+		}
+	}
+	v.check(alerts.Retries >= 0, "Alerts.Retries", alerts.Retries, "must not be negative")
+	v.check(alerts.Backoff >= 0, "Alerts.Backoff", alerts.Backoff, "must not be negative")
+	v.check(alerts.DedupWindow >= 0, "Alerts.DedupWindow", alerts.DedupWindow, "must not be negative")
+
+	parser := properties.Parser
+	v.checkURL("parser.catalog.baseUrl", parser.Catalog.BaseUrl)
+	v.check(parser.Catalog.PageSize > 0, "parser.catalog.pageSize", parser.Catalog.PageSize, "must be positive")
+	v.checkURL("parser.url", parser.URL)
+
+	config := parser.HTTP
+	v.check(config.ConnectTimeout > 0, "parser.http.connectTimeout", config.ConnectTimeout, "must be positive")
+	v.check(config.ReadTimeout > 0, "parser.http.readTimeout", config.ReadTimeout, "must be positive")
+	v.check(config.Retries >= 0, "parser.http.retries", config.Retries, "must not be negative")
+	v.check(config.Backoff >= 0, "parser.http.backoff", config.Backoff, "must not be negative")
+	v.check(config.MaxBackoff >= config.Backoff, "parser.http.maxBackoff", config.MaxBackoff,
+		"must not be less than parser.http.backoff")
+	if _, err := parseHeaders(config.Headers); err != nil {
+		v.check(false, "parser.http.headers", redactString(redactHeaders, config.Headers), err.Error())
+	}
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		v.check(err == nil && (proxyURL.Scheme == "http" || proxyURL.Scheme == "https" || proxyURL.Scheme == "socks5"),
+			"parser.http.proxy", redactString(redactURL, config.Proxy), "must be http://, https:// or socks5:// URL")
+	}
+	v.check(config.CircuitBreaker.Threshold >= 0, "parser.http.circuitBreaker.threshold",
+		config.CircuitBreaker.Threshold, "must not be negative, 0 disables the circuit breaker")
+	v.check(config.CircuitBreaker.Cooldown > 0 || config.CircuitBreaker.Threshold == 0,
+		"parser.http.circuitBreaker.cooldown", config.CircuitBreaker.Cooldown, "must be positive")
+	v.check(!config.Cache.Enabled || config.Cache.Path != "", "parser.http.cache.path", config.Cache.Path,
+		"is required while the cache is enabled")
+	v.check(config.Limits.Catalog >= 0, "parser.http.limits.catalog", config.Limits.Catalog,
+		"must not be negative, 0 means no limit")
+	v.check(config.Limits.Page >= 0, "parser.http.limits.page", config.Limits.Page,
+		"must not be negative, 0 means no limit")
+
+	v.check(!properties.Storage.Enabled || properties.Storage.Path != "", "storage.path", properties.Storage.Path,
+		"is required while the storage is enabled")
+	v.check(!properties.Scheduler.Enabled || properties.Scheduler.Interval > 0, "scheduler.interval",
+		properties.Scheduler.Interval, "must be positive while the scheduler is enabled")
+	v.check(properties.Health.ScrapeWindow >= 0, "health.scrapeWindow", properties.Health.ScrapeWindow,
+		"must not be negative, 0 disables the check")
+	v.check(properties.Jobs.TTL > 0, "jobs.ttl", properties.Jobs.TTL, "must be positive")
+
+	return v.problems
+}
+
+// configValidationError converts the problems to the HTTPError, returns nil if there are no problems.
+func configValidationError(problems []configProblem) *entities.HTTPError {
+	if len(problems) == 0 {
+		return nil
+	}
+	var details []entities.HTTPErrorDetails
+	for _, problem := range problems {
+		details = append(details, entities.HTTPErrorDetails{
+			Reason:       problem.message,
+			Message:      "wrong configuration value",
+			Location:     problem.path,
+			LocationType: "property",
+			ExtendedHelp: fmt.Sprintf("current value: %v", problem.value),
+		})
+	}
+	return entities.WrapErrors("configuration is invalid", errorConfigInvalid, details...)
+}
+
+// configValidateHandler serves GET /config/validate which validates the running configuration and
+// POST /config/validate which validates HOCON configuration given in the body over defaults.
+func configValidateHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("new request")
+
+	properties := getProperties()
+	source := "running"
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err == nil {
+			properties = &Properties{}
+			err = hocon.LoadConfigText(string(body), properties)
+		}
+		if err != nil {
+			writeHTTPResponse(w, http.StatusBadRequest, entities.NewHTTPResponse(nil,
+				entities.WrapErrors("cannot parse configuration", errorConfigInvalid, entities.HTTPErrorDetails{
+					Reason:       err.Error(),
+					Message:      "cannot parse configuration",
+					Location:     "body",
+					LocationType: "body",
+				}), 1, r.URL.Path))
+			return
+		}
+		source = "body"
+	default:
+		writeHTTPResponse(w, http.StatusMethodNotAllowed, entities.NewHTTPResponse(nil,
+			entities.WrapErrors("method not allowed", errorConfigInvalid, entities.HTTPErrorDetails{
+				Reason:       r.Method,
+				Message:      "method not allowed",
+				Location:     "method",
+				LocationType: "method",
+				ExtendedHelp: "use GET to validate running configuration or POST to validate the body",
+			}), 1, r.URL.Path))
+		return
+	}
+
+	problems := validateProperties(properties)
+	data := &entities.ConfigValidationHTTPData{Source: source, Valid: len(problems) == 0, ProblemsCount: len(problems)}
+	status := http.StatusOK
+	if len(problems) != 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeHTTPResponse(w, status, entities.NewHTTPResponse(data, configValidationError(problems), 1, r.URL.Path))
+}
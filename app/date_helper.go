@@ -8,6 +8,9 @@ import (
 const thisYearDateLayout = "02 Jan, 15:04"
 const anotherYearDateLayout = "02 Jan 2006, 15:04"
 
+// clock is the clock of the parser, tests pin it to get reproducible results.
+var clock = time.Now
+
 var localMonths = map[string]string{
 	"янв": "Jan",
 	"фев": "Feb",
@@ -39,5 +42,5 @@ func parseTime(dateString string) (time.Time, error) {
 	if err1 != nil {
 		return time.Parse(anotherYearDateLayout, dateStringEng)
 	}
-	return result.AddDate(time.Now().Year(), 0, 0), nil
+	return result.AddDate(clock().Year(), 0, 0), nil
 }
@@ -131,6 +131,13 @@ func Test_replaceMonth(t *testing.T) {
 }
 
 func Test_parseDate(t *testing.T) {
+	defer func() {
+		clock = time.Now
+	}()
+	clock = func() time.Time {
+		return time.Date(2020, 2, 10, 0, 0, 0, 0, time.UTC)
+	}
+
 	type args struct {
 		dateString string
 	}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+// Alert is a match of an alert rule, it is delivered to webhooks as JSON. ForecastID is set for
+// rules checking single forecasts.
+type Alert struct {
+	ID         string    `json:"id"`
+	Rule       string    `json:"rule"`
+	Ticker     string    `json:"ticker"`
+	Metric     string    `json:"metric"`
+	Condition  string    `json:"condition"`
+	Threshold  float64   `json:"threshold"`
+	Value      float64   `json:"value"`
+	Previous   *float64  `json:"previous,omitempty"`
+	ForecastID string    `json:"forecastId,omitempty"`
+	Time       time.Time `json:"time"`
+}
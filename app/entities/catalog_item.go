@@ -24,3 +24,10 @@ func NewCatalogHTTPData(data *[]CatalogItem) *CatalogHTTPData {
 		Items:      *data,
 	}
 }
+
+// CatalogStreamTrailer is the last record of NDJSON catalog stream.
+type CatalogStreamTrailer struct {
+	ItemsCount int        `json:"itemsCount"`
+	PagesCount int        `json:"pagesCount"`
+	Error      *HTTPError `json:"error"`
+}
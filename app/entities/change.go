@@ -0,0 +1,24 @@
+package entities
+
+import "time"
+
+// ForecastChange is a change of the forecast between two scrapes: new, revised or withdrawn.
+// Direction and PreviousTarget are set for revised forecasts only.
+type ForecastChange struct {
+	ScrapeID       uint64    `json:"scrapeId"`
+	Time           time.Time `json:"time"`
+	Ticker         string    `json:"ticker"`
+	Type           string    `json:"type"`
+	Direction      string    `json:"direction,omitempty"`
+	ForecastID     string    `json:"forecastId"`
+	Analyst        string    `json:"analyst"`
+	ForecastTime   time.Time `json:"forecastTime"`
+	Target         float64   `json:"target"`
+	PreviousTarget float64   `json:"previousTarget,omitempty"`
+}
+
+type ChangesHTTPData struct {
+	Since        time.Time        `json:"since"`
+	ChangesCount int              `json:"changesCount"`
+	Changes      []ForecastChange `json:"changes"`
+}
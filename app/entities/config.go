@@ -0,0 +1,26 @@
+package entities
+
+// ConfigValidationHTTPData is a result of configuration validation, problems are listed in the errors
+// of the response.
+type ConfigValidationHTTPData struct {
+	Source        string `json:"source"`
+	Valid         bool   `json:"valid"`
+	ProblemsCount int    `json:"problemsCount"`
+}
+
+// ConfigHTTPData is the effective configuration. File is the configuration file path, it may not exist.
+type ConfigHTTPData struct {
+	File       string           `json:"file"`
+	Properties []ConfigProperty `json:"properties"`
+}
+
+// ConfigProperty is a property value with its origin: default, file, env or flag. Source is the file path,
+// the environment variable or the flag name which set the value.
+type ConfigProperty struct {
+	Path     string      `json:"path"`
+	Value    interface{} `json:"value"`
+	Origin   string      `json:"origin"`
+	Source   string      `json:"source,omitempty"`
+	Env      string      `json:"env"`
+	Redacted bool        `json:"redacted,omitempty"`
+}
@@ -0,0 +1,21 @@
+package entities
+
+// HealthHTTPData is a liveness status, the process is alive if it responds at all.
+type HealthHTTPData struct {
+	Status   string `json:"status"`
+	Revision string `json:"revision"`
+}
+
+// ReadinessHTTPData is a result of readiness checks, failing checks are also listed in the errors
+// of the response.
+type ReadinessHTTPData struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is a result of one readiness check, Status is pass or fail.
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
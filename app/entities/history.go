@@ -0,0 +1,20 @@
+package entities
+
+import "time"
+
+type HistoryHTTPData struct {
+	Ticker   string         `json:"ticker"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Interval string         `json:"interval,omitempty"`
+	Points   []HistoryPoint `json:"points"`
+}
+
+// HistoryPoint is a state of the ticker at the time. Consensus is absent if the ticker did not pass
+// the filters, ForecastsCount counts all parsed forecasts.
+type HistoryPoint struct {
+	Time           time.Time `json:"time"`
+	Price          float64   `json:"price"`
+	Consensus      *float64  `json:"consensus"`
+	ForecastsCount int       `json:"forecastsCount"`
+}
@@ -0,0 +1,19 @@
+package entities
+
+import "time"
+
+type JobHTTPData struct {
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	Status   string      `json:"status"`
+	Created  time.Time   `json:"created"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Progress JobProgress `json:"progress"`
+}
+
+type JobProgress struct {
+	PagesDone  int      `json:"pagesDone"`
+	PagesTotal int      `json:"pagesTotal"`
+	Ongoing    int      `json:"ongoing"`
+	Errors     []string `json:"errors"`
+}
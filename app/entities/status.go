@@ -0,0 +1,19 @@
+package entities
+
+import "time"
+
+type StatusHTTPData struct {
+	Revision  string           `json:"revision"`
+	Upstreams []UpstreamStatus `json:"upstreams"`
+}
+
+// UpstreamStatus is a state of the circuit breaker of an upstream host.
+type UpstreamStatus struct {
+	Host                string     `json:"host"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
+}
@@ -0,0 +1,26 @@
+package entities
+
+import "time"
+
+// TickerUpdate is a change of the ticker made by a scrape. Kinds lists what changed: consensus, price
+// and forecasts. Consensus is nil if the ticker did not pass the filters, Changes are forecast changes
+// of the ticker detected by the scrape.
+type TickerUpdate struct {
+	ScrapeID          uint64           `json:"scrapeId"`
+	Time              time.Time        `json:"time"`
+	Ticker            string           `json:"ticker"`
+	Name              string           `json:"name"`
+	Kinds             []string         `json:"kinds"`
+	Price             float64          `json:"price"`
+	PreviousPrice     float64          `json:"previousPrice"`
+	Consensus         *float64         `json:"consensus"`
+	PreviousConsensus *float64         `json:"previousConsensus"`
+	Changes           []ForecastChange `json:"changes,omitempty"`
+}
+
+// StreamReset is sent to a resumed stream if some updates since Last-Event-ID are not kept anymore,
+// the client should reload the tickers.
+type StreamReset struct {
+	LastEventID string `json:"lastEventId"`
+	Message     string `json:"message"`
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatXLSX = "xlsx"
+
+	csvMediaType  = "text/csv"
+	xlsxMediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+	// russianDateLayout is the date format of the Russian locale.
+	russianDateLayout = "02.01.2006"
+)
+
+// exportFormat negotiates /ticker/ response format: format parameter (json, csv or xlsx) wins over
+// Accept header, JSON is the default.
+func exportFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case formatJSON, formatCSV, formatXLSX:
+			return format, nil
+		}
+		return "", fmt.Errorf("unknown format %s, expected %s, %s or %s", format, formatJSON, formatCSV, formatXLSX)
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case csvMediaType:
+			return formatCSV, nil
+		case xlsxMediaType:
+			return formatXLSX, nil
+		case "application/json", "*/*":
+			return formatJSON, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// writeExport writes tickers as CSV or XLSX attachment.
+func writeExport(w http.ResponseWriter, format string, tickers *tickerCollection, at time.Time) {
+	mediaType, extension := csvMediaType+"; charset=utf-8", "csv"
+	if format == formatXLSX {
+		mediaType, extension = xlsxMediaType, "xlsx"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tickers-%s.%s"`,
+		at.Format("2006-01-02"), extension))
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+	if format == formatXLSX {
+		err = writeXLSX(w, tickerSheets(tickers))
+	} else {
+		err = writeRussianCSV(w, tickerSheets(tickers)[0])
+	}
+	if err != nil {
+		serverLog.Errorf("cannot write %s export: %s", format, err)
+	}
+}
+
+// tickerSheets returns the consensus sheet with one row per ticker and the forecasts sheet with one
+// row per forecast. Scraped texts are escaped by spreadsheetText.
+func tickerSheets(tickers *tickerCollection) []xlsxSheet {
+	consensus := xlsxSheet{
+		name:   "Консенсус",
+		header: []string{"Тикер", "Название", "Цена", "Консенсус, %", "Прогнозов"},
+	}
+	forecasts := xlsxSheet{
+		name:   "Прогнозы",
+		header: []string{"Тикер", "Цель", "Отклонение, %", "Дата", "Аналитик"},
+	}
+
+	if tickers.Tickers == nil {
+		return []xlsxSheet{consensus, forecasts}
+	}
+	for _, ticker := range *tickers.Tickers {
+		var tickerForecasts []forecast
+		if ticker.Forecasts != nil {
+			tickerForecasts = *ticker.Forecasts
+		}
+		consensus.rows = append(consensus.rows, []interface{}{
+			spreadsheetText(ticker.Name.Short), spreadsheetText(ticker.Name.Full), ticker.CurrentPrice, ticker.Consensus,
+			len(tickerForecasts),
+		})
+		for _, forecast := range tickerForecasts {
+			forecasts.rows = append(forecasts.rows, []interface{}{
+				spreadsheetText(ticker.Name.Short), forecast.Target, forecast.ExpectedDiff, forecast.Time,
+				spreadsheetText(forecast.Analyst),
+			})
+		}
+	}
+	return []xlsxSheet{consensus, forecasts}
+}
+
+// spreadsheetText prefixes the text with apostrophe if it starts like a formula, so a spreadsheet
+// shows scraped text instead of evaluating it.
+func spreadsheetText(text string) string {
+	if text != "" && strings.ContainsAny(text[:1], "=+-@\t\r") {
+		return "'" + text
+	}
+	return text
+}
+
+// writeRussianCSV writes the sheet as CSV the way spreadsheets of the Russian locale open it: UTF-8 with
+// BOM, semicolon separated, decimal comma and dd.mm.yyyy dates.
+func writeRussianCSV(w io.Writer, sheet xlsxSheet) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = ';'
+	writer.UseCRLF = true
+
+	if err := writer.Write(sheet.header); err != nil {
+		return err
+	}
+	for _, row := range sheet.rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			switch v := value.(type) {
+			case float64:
+				rounded := math.Round(v*10000) / 10000
+				record[i] = strings.Replace(strconv.FormatFloat(rounded, 'f', -1, 64), ".", ",", 1)
+			case time.Time:
+				record[i] = v.Format(russianDateLayout)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExportTickers() *tickerCollection {
+	forecasts := []forecast{
+		{Analyst: "Иванов", Target: 110.5, ExpectedDiff: 10.5, Time: time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)},
+	}
+	return &tickerCollection{Tickers: &[]stockTicker{
+		{Name: tickerName{Full: "Сбербанк", Short: "SBER"}, CurrentPrice: 100, Consensus: 10.5, Forecasts: &forecasts},
+	}}
+}
+
+func Test_exportFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		accept  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", url: "/ticker/", want: formatJSON},
+		{name: "accept csv", url: "/ticker/", accept: "text/csv", want: formatCSV},
+		{name: "accept xlsx with quality", url: "/ticker/", accept: "text/html;q=0.9, " + xlsxMediaType + ";q=0.8", want: formatXLSX},
+		{name: "parameter wins", url: "/ticker/?format=xlsx", accept: "text/csv", want: formatXLSX},
+		{name: "unknown parameter", url: "/ticker/?format=xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			r.Header.Set("Accept", tt.accept)
+			got, err := exportFormat(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exportFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("exportFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_spreadsheetText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "Сбербанк", want: "Сбербанк"},
+		{name: "empty", text: "", want: ""},
+		{name: "formula", text: "=HYPERLINK(\"http://example.com\")", want: "'=HYPERLINK(\"http://example.com\")"},
+		{name: "plus", text: "+1", want: "'+1"},
+		{name: "minus", text: "-1+2", want: "'-1+2"},
+		{name: "at", text: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "inner sign", text: "A=B", want: "A=B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spreadsheetText(tt.text); got != tt.want {
+				t.Errorf("spreadsheetText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeRussianCSV(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := writeRussianCSV(&buffer, tickerSheets(testExportTickers())[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\ufeffТикер;Название;Цена;Консенсус, %;Прогнозов\r\nSBER;Сбербанк;100;10,5;1\r\n"
+	if buffer.String() != want {
+		t.Errorf("writeRussianCSV() = %q, want %q", buffer.String(), want)
+	}
+}
+
+func Test_writeXLSX(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := writeXLSX(&buffer, tickerSheets(testExportTickers())); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("writeXLSX() wrote not a zip: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		data, _ := ioutil.ReadAll(reader)
+		parts[file.Name] = string(data)
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Консенсус"`) || !strings.Contains(parts["xl/workbook.xml"], `name="Прогнозы"`) {
+		t.Errorf("workbook.xml = %s, want two sheets", parts["xl/workbook.xml"])
+	}
+	// 5 Mar 2020 12:00 is 43895.5 days since 30 Dec 1899
+	if !strings.Contains(parts["xl/worksheets/sheet2.xml"], `<c r="D2" s="2"><v>43895.5</v></c>`) {
+		t.Errorf("sheet2.xml = %s, want date cell", parts["xl/worksheets/sheet2.xml"])
+	}
+}
+
+func Test_xlsxColumn(t *testing.T) {
+	for index, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(index); got != want {
+			t.Errorf("xlsxColumn(%d) = %v, want %v", index, got, want)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+//go:generate protoc -I proto --go_out=paths=source_relative:proto --go-grpc_out=paths=source_relative:proto proto/ticker_parser.proto
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"net"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"ticker-parser/app/entities"
+	pb "ticker-parser/app/proto"
+	"time"
+)
+
+const (
+	errorGRPCRequest  = 1601
+	errorGRPCNotFound = 1602
+
+	// grpcMaxMessageSize limits request messages, all requests of the API are tiny.
+	grpcMaxMessageSize = 1 << 20
+)
+
+var (
+	grpcCalls = metrics.counter("ticker_parser_grpc_calls_total",
+		"Finished gRPC calls by method and status code.", "method", "code")
+	grpcCallDuration = metrics.histogram("ticker_parser_grpc_call_duration_seconds",
+		"Duration of gRPC calls by method.", durationBuckets, "method")
+)
+
+// grpcFailure converts the error of the service layer to the status of the call, Error is sent in its
+// details as the JSON API sends it in the response envelope. The code is chosen by the HTTP status
+// the JSON API would respond with.
+func grpcFailure(httpStatus int, httpError *entities.HTTPError) error {
+	code := codes.Internal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusPreconditionFailed:
+		code = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+
+	message := httpError.Message
+	if len(httpError.Errors) != 0 && httpError.Errors[0].Message != message {
+		message += ": " + httpError.Errors[0].Message
+	}
+	failure, err := status.New(code, message).WithDetails(errorMessage(httpError))
+	if err != nil {
+		serverLog.Errorf("cannot attach error details to gRPC status: %s", err)
+		return status.Error(code, message)
+	}
+	return failure.Err()
+}
+
+func grpcRequestError(field string, err error) error {
+	return grpcFailure(http.StatusBadRequest, entities.WrapErrors("wrong request", errorGRPCRequest,
+		entities.HTTPErrorDetails{
+			Reason:       err.Error(),
+			Message:      "wrong " + field,
+			Location:     field,
+			LocationType: "field",
+			ExtendedHelp: "see proto/ticker_parser.proto for the messages",
+		}))
+}
+
+// grpcClosed returns the status of the call cancelled by the client or by its deadline.
+func grpcClosed(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+	return status.Error(codes.Canceled, "call cancelled")
+}
+
+// grpcServer serves the gRPC API on its own port, runServer runs it like the HTTP server.
+type grpcServer struct {
+	addr   string
+	server *grpc.Server
+}
+
+// newGRPCServer creates the server of the gRPC API. Clients speak HTTP/2 without TLS.
+func newGRPCServer(port int64) *grpcServer {
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(grpcMaxMessageSize),
+		grpc.UnaryInterceptor(grpcUnaryInterceptor),
+		grpc.StreamInterceptor(grpcStreamInterceptor),
+	)
+	pb.RegisterTickerParserServer(server, &grpcService{})
+	return &grpcServer{addr: fmt.Sprintf(":%d", port), server: server}
+}
+
+func (ptr *grpcServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", ptr.addr)
+	if err != nil {
+		return err
+	}
+	return ptr.server.Serve(listener)
+}
+
+// Shutdown stops accepting connections and waits until running calls finish or ctx is done.
+func (ptr *grpcServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		ptr.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close cancels running calls and closes the connections.
+func (ptr *grpcServer) Close() error {
+	ptr.server.Stop()
+	return nil
+}
+
+func grpcUnaryInterceptor(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, finish := startGRPCCall(ctx, info.FullMethod)
+	response, err := handler(ctx, request)
+	finish(err)
+	return response, err
+}
+
+func grpcStreamInterceptor(service interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	ctx, finish := startGRPCCall(stream.Context(), info.FullMethod)
+	err := handler(service, &grpcServerStream{ServerStream: stream, ctx: ctx})
+	finish(err)
+	return err
+}
+
+// grpcServerStream replaces the context of the stream.
+type grpcServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ptr *grpcServerStream) Context() context.Context {
+	return ptr.ctx
+}
+
+// startGRPCCall does for the call what withRequestID and instrument do for HTTP requests: takes
+// x-request-id of the metadata or generates a new one and sends it back in the header, traces the call
+// continuing traceparent of the metadata and logs it. The returned function records the result.
+func startGRPCCall(ctx context.Context, fullMethod string) (context.Context, func(err error)) {
+	start := time.Now()
+	method := path.Base(fullMethod)
+	header := grpcHeader(ctx)
+
+	id := header.Get(requestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = newRequestID()
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id)); err != nil {
+		serverLog.Errorf("cannot send request ID of gRPC call: %s", err)
+	}
+	ctx = withLogFields(ctx, log.Fields{"request_id": id})
+
+	ctx, span := startSpan(withRemoteParent(ctx, header), fullMethod, spanKindServer)
+	span.setAttribute("rpc.system", "grpc")
+	span.setAttribute("rpc.method", method)
+	span.setAttribute("request_id", id)
+	logger(ctx, serverLog).WithField("method", method).Info("new call")
+
+	return ctx, func(err error) {
+		code := status.Code(err)
+		grpcCalls.add(1, method, strconv.Itoa(int(code)))
+		grpcCallDuration.observe(time.Since(start).Seconds(), method)
+
+		span.setAttribute("rpc.grpc.status_code", int(code))
+		switch code {
+		case codes.Unknown, codes.Internal, codes.Unimplemented, codes.Unavailable, codes.DataLoss:
+			span.recordError(err)
+		}
+		span.finish()
+		if err != nil {
+			logger(ctx, serverLog).WithField("method", method).Warnf("call failed with code %s: %s", code,
+				status.Convert(err).Message())
+		}
+	}
+}
+
+// grpcHeader returns the metadata of the call as HTTP header.
+func grpcHeader(ctx context.Context) http.Header {
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		header[textproto.CanonicalMIMEHeaderKey(name)] = values
+	}
+	return header
+}
+
+// grpcAuthorize checks the API key of the call as authorize does for HTTP requests, the key is sent in
+// the metadata under the name of auth.header. The returned context logs the name of the key.
+func grpcAuthorize(ctx context.Context, scope string) (context.Context, error) {
+	properties := getProperties()
+	if !properties.Auth.Enabled {
+		return ctx, nil
+	}
+
+	key, rejection := authenticate(properties, grpcHeader(ctx))
+	if rejection == nil {
+		ctx = withLogFields(ctx, log.Fields{"client": key.name})
+		rejection = permit(properties, key, scope)
+	}
+	if rejection == nil {
+		return ctx, nil
+	}
+	authRejections.add(1, rejection.reason)
+	return ctx, grpcFailure(rejection.status, rejection.httpError())
+}
+
+// grpcService implements TickerParser service of proto/ticker_parser.proto by the service layer of
+// the HTTP API.
+type grpcService struct {
+	pb.UnimplementedTickerParserServer
+}
+
+// tickers scrapes tickers or rebuilds them from the history if asOf is set.
+func (ptr *grpcService) tickers(ctx context.Context, asOf string) (*tickerCollection, error) {
+	if asOf == "" {
+		ctx, err := grpcAuthorize(ctx, scopeRefresh)
+		if err != nil {
+			return nil, err
+		}
+		tickers, err := doTheJob(ctx)
+		if ctx.Err() != nil {
+			return nil, grpcClosed(ctx)
+		}
+		if err != nil {
+			httpError := wrapTickerError(err)
+			if httpError.Code == errorUpstreamUnavailable {
+				return nil, grpcFailure(http.StatusServiceUnavailable, httpError)
+			}
+			return nil, grpcFailure(http.StatusInternalServerError, httpError)
+		}
+		return tickers, nil
+	}
+
+	if _, err := grpcAuthorize(ctx, scopeRead); err != nil {
+		return nil, err
+	}
+	tickers, httpStatus, httpError := loadTickersAsOf(asOf, "as_of")
+	if httpError != nil {
+		return nil, grpcFailure(httpStatus, httpError)
+	}
+	return tickers, nil
+}
+
+func (ptr *grpcService) ListTickers(ctx context.Context, request *pb.ListTickersRequest) (*pb.ListTickersResponse, error) {
+	tickers, err := ptr.tickers(ctx, request.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	watched := watchedTickers(request.Tickers)
+	response := &pb.ListTickersResponse{}
+	for _, ticker := range *tickers.Tickers {
+		if watched(ticker.Name.Short) {
+			response.Tickers = append(response.Tickers, tickerMessage(ticker))
+		}
+	}
+	return response, nil
+}
+
+func (ptr *grpcService) GetTicker(ctx context.Context, request *pb.GetTickerRequest) (*pb.Ticker, error) {
+	if request.Ticker == "" {
+		return nil, grpcRequestError("ticker", fmt.Errorf("ticker is required"))
+	}
+
+	tickers, err := ptr.tickers(ctx, request.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ticker := range *tickers.Tickers {
+		if strings.EqualFold(ticker.Name.Short, request.Ticker) {
+			return tickerMessage(ticker), nil
+		}
+	}
+	return nil, grpcFailure(http.StatusNotFound, entities.WrapErrors("ticker not found", errorGRPCNotFound,
+		entities.HTTPErrorDetails{
+			Reason:       fmt.Sprintf("ticker %s is unknown or did not pass the filters", request.Ticker),
+			Message:      "ticker not found",
+			Location:     "ticker",
+			LocationType: "field",
+		}))
+}
+
+func (ptr *grpcService) FetchCatalog(ctx context.Context, _ *pb.FetchCatalogRequest) (*pb.FetchCatalogResponse, error) {
+	ctx, err := grpcAuthorize(ctx, scopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	data, httpError := catalogFetch(ctx)
+	if ctx.Err() != nil {
+		return nil, grpcClosed(ctx)
+	}
+	if httpError != nil {
+		if httpError.Code == errorUpstreamUnavailable {
+			return nil, grpcFailure(http.StatusServiceUnavailable, httpError)
+		}
+		return nil, grpcFailure(http.StatusInternalServerError, httpError)
+	}
+	logger(ctx, catalogLog).Infof("%d items fetched", data.ItemsCount)
+
+	response := &pb.FetchCatalogResponse{ItemsCount: int64(data.ItemsCount)}
+	for _, item := range data.Items {
+		response.Items = append(response.Items, catalogItemMessage(item))
+	}
+	return response, nil
+}
+
+// WatchConsensusChanges streams consensus changes until the call is cancelled or the server shuts down.
+func (ptr *grpcService) WatchConsensusChanges(request *pb.WatchConsensusChangesRequest,
+	stream pb.TickerParser_WatchConsensusChangesServer) error {
+	ctx, err := grpcAuthorize(stream.Context(), scopeRead)
+	if err != nil {
+		return err
+	}
+
+	sub := tickerUpdates.subscribe("")
+	defer sub.cancel()
+	watched := watchedTickers(request.Tickers)
+
+	// headers are sent at once, so the client knows the call is accepted
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return grpcClosed(ctx)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return grpcClosed(ctx)
+		case <-shuttingDown:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case update, ok := <-sub.updates:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "updates are not received in time")
+			}
+			if !hasUpdateKind(update.TickerUpdate, updateKindConsensus) || !watched(update.Ticker) {
+				continue
+			}
+			if err := stream.Send(consensusChangeMessage(update.TickerUpdate)); err != nil {
+				return grpcClosed(ctx)
+			}
+		}
+	}
+}
+
+func tickerNameMessage(name tickerName) *pb.TickerName {
+	return &pb.TickerName{Full: name.Full, Short: name.Short}
+}
+
+func tickerMessage(ticker stockTicker) *pb.Ticker {
+	message := &pb.Ticker{
+		Name:      tickerNameMessage(ticker.Name),
+		Price:     ticker.CurrentPrice,
+		Consensus: ticker.Consensus,
+	}
+	if ticker.Forecasts == nil {
+		return message
+	}
+	for _, forecast := range *ticker.Forecasts {
+		message.Forecasts = append(message.Forecasts, &pb.Forecast{
+			Id:           forecast.ID,
+			Analyst:      forecast.Analyst,
+			Target:       forecast.Target,
+			ExpectedDiff: forecast.ExpectedDiff,
+			Time:         timestamppb.New(forecast.Time),
+		})
+	}
+	return message
+}
+
+func catalogItemMessage(item entities.CatalogItem) *pb.CatalogItem {
+	return &pb.CatalogItem{
+		Title: item.Title,
+		Url:   item.URL,
+		Type:  item.Type,
+		Company: &pb.CatalogItem_Company{
+			Name: item.Company.Name,
+			Logo: item.Company.Logo,
+			Url:  item.Company.URL,
+		},
+		Price:    item.Price,
+		Currency: item.Currency,
+	}
+}
+
+func consensusChangeMessage(update entities.TickerUpdate) *pb.ConsensusChange {
+	message := &pb.ConsensusChange{
+		ScrapeId:      update.ScrapeID,
+		Time:          timestamppb.New(update.Time),
+		Name:          tickerNameMessage(tickerName{Full: update.Name, Short: update.Ticker}),
+		Price:         update.Price,
+		PreviousPrice: update.PreviousPrice,
+	}
+	if update.Consensus != nil {
+		message.Consensus = wrapperspb.Double(*update.Consensus)
+	}
+	if update.PreviousConsensus != nil {
+		message.PreviousConsensus = wrapperspb.Double(*update.PreviousConsensus)
+	}
+	return message
+}
+
+func errorMessage(httpError *entities.HTTPError) *pb.Error {
+	message := &pb.Error{Message: httpError.Message, Code: int32(httpError.Code)}
+	for _, details := range httpError.Errors {
+		message.Errors = append(message.Errors, &pb.ErrorDetails{
+			Domain:       details.Domain,
+			Reason:       details.Reason,
+			Message:      details.Message,
+			Location:     details.Location,
+			LocationType: details.LocationType,
+			ExtendedHelp: details.ExtendedHelp,
+			SendReport:   details.SendReport,
+		})
+	}
+	return message
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+	"ticker-parser/app/entities"
+	pb "ticker-parser/app/proto"
+	"time"
+)
+
+// startTestGRPCServer serves the gRPC API on a random local port and connects to it, the returned
+// function closes the connection and stops the server.
+func startTestGRPCServer(t *testing.T) (*grpc.ClientConn, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newGRPCServer(0)
+	go func() { _ = server.server.Serve(listener) }()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		_ = server.Close()
+		t.Fatal(err)
+	}
+	return conn, func() {
+		_ = conn.Close()
+		_ = server.Close()
+	}
+}
+
+// grpcErrorCode returns the code of Error sent in the details of the status, 0 if there is no Error.
+func grpcErrorCode(t *testing.T, err error) int {
+	for _, details := range status.Convert(err).Details() {
+		switch details := details.(type) {
+		case *pb.Error:
+			return int(details.Code)
+		case error:
+			t.Fatalf("cannot decode status details: %v", details)
+		}
+	}
+	return 0
+}
+
+func Test_grpcService(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+	at := time.Date(2020, 3, 20, 10, 0, 0, 0, time.UTC)
+	var forecasts []forecast
+	for i := 0; i < 5; i++ {
+		forecasts = append(forecasts, forecast{ID: string(rune('a' + i)), Analyst: "analyst", ExpectedDiff: 10, Time: at})
+	}
+	if err := store.SaveScrape(&scrapeRecord{Time: at, Tickers: []tickerRecord{
+		{Name: tickerName{Full: "Sberbank", Short: "SBER"}, Price: 100, Forecasts: forecasts},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	properties := validTestProperties(t)
+	properties.Auth.Enabled = true
+	properties.Auth.Keys = "reader " + hashAPIKey("read-key") + " read"
+	propsMu.Lock()
+	saved, savedHistory := props, history
+	props = properties
+	propsMu.Unlock()
+	defer func() {
+		propsMu.Lock()
+		props, history = saved, savedHistory
+		propsMu.Unlock()
+	}()
+
+	conn, stop := startTestGRPCServer(t)
+	defer stop()
+	client := pb.NewTickerParserClient(conn)
+
+	readKey := metadata.Pairs("x-api-key", "read-key")
+	tests := []struct {
+		name     string
+		history  historyStore
+		md       metadata.MD
+		call     func(ctx context.Context) error
+		wantCode codes.Code
+		wantErr  int
+	}{
+		{name: "unknown method", call: func(ctx context.Context) error {
+			return conn.Invoke(ctx, "/tickerparser.v1.TickerParser/Unknown", &pb.FetchCatalogRequest{},
+				&pb.FetchCatalogResponse{})
+		}, wantCode: codes.Unimplemented},
+		{name: "missing key", call: func(ctx context.Context) error {
+			_, err := client.ListTickers(ctx, &pb.ListTickersRequest{})
+			return err
+		}, wantCode: codes.Unauthenticated, wantErr: errorAuthMissing},
+		{name: "no refresh scope", md: readKey, call: func(ctx context.Context) error {
+			_, err := client.FetchCatalog(ctx, &pb.FetchCatalogRequest{})
+			return err
+		}, wantCode: codes.PermissionDenied, wantErr: errorAuthScope},
+		{name: "history disabled", md: readKey, call: func(ctx context.Context) error {
+			_, err := client.ListTickers(ctx, &pb.ListTickersRequest{AsOf: "2020-03-20"})
+			return err
+		}, wantCode: codes.FailedPrecondition, wantErr: errorHistoryUnavailable},
+		{name: "wrong as_of", history: store, md: readKey, call: func(ctx context.Context) error {
+			_, err := client.ListTickers(ctx, &pb.ListTickersRequest{AsOf: "20.03.2020"})
+			return err
+		}, wantCode: codes.InvalidArgument, wantErr: errorHistoryRequest},
+		{name: "ticker required", md: readKey, call: func(ctx context.Context) error {
+			_, err := client.GetTicker(ctx, &pb.GetTickerRequest{})
+			return err
+		}, wantCode: codes.InvalidArgument, wantErr: errorGRPCRequest},
+		{name: "ticker not found", history: store, md: readKey, call: func(ctx context.Context) error {
+			_, err := client.GetTicker(ctx, &pb.GetTickerRequest{Ticker: "GAZP", AsOf: "2020-03-21"})
+			return err
+		}, wantCode: codes.NotFound, wantErr: errorGRPCNotFound},
+		{name: "ticker as of", history: store, md: readKey, call: func(ctx context.Context) error {
+			ticker, err := client.GetTicker(ctx, &pb.GetTickerRequest{Ticker: "sber", AsOf: "2020-03-21"})
+			if err != nil {
+				return err
+			}
+			if ticker.Name.GetShort() != "SBER" || ticker.Name.GetFull() != "Sberbank" || ticker.Price != 100 ||
+				len(ticker.Forecasts) != 5 || !ticker.Forecasts[0].Time.AsTime().Equal(at) {
+				t.Errorf("GetTicker() = %v, want SBER with 5 forecasts", ticker)
+			}
+			return nil
+		}, wantCode: codes.OK},
+		{name: "tickers as of", history: store, md: readKey, call: func(ctx context.Context) error {
+			response, err := client.ListTickers(ctx, &pb.ListTickersRequest{AsOf: "2020-03-21", Tickers: []string{"gazp"}})
+			if err == nil && len(response.Tickers) != 0 {
+				t.Errorf("ListTickers() = %v, want no tickers of GAZP", response)
+			}
+			return err
+		}, wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history = tt.history
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if tt.md != nil {
+				ctx = metadata.NewOutgoingContext(ctx, tt.md)
+			}
+
+			err := tt.call(ctx)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %s (%v), want %s", code, err, tt.wantCode)
+			}
+			if code := grpcErrorCode(t, err); code != tt.wantErr {
+				t.Errorf("error code = %d, want %d", code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_grpcService_WatchConsensusChanges(t *testing.T) {
+	conn, stop := startTestGRPCServer(t)
+	defer stop()
+	client := pb.NewTickerParserClient(conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.WatchConsensusChanges(ctx, &pb.WatchConsensusChangesRequest{Tickers: []string{"sber"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := header.Get(requestIDHeader); len(ids) != 1 || !requestIDPattern.MatchString(ids[0]) {
+		t.Errorf("Header() request ID = %v, want generated ID", ids)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		tickerUpdates.mu.Lock()
+		subscribed := len(tickerUpdates.subscribers) != 0
+		tickerUpdates.mu.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the call did not subscribe to updates")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	consensus := 12.5
+	at := time.Date(2020, 3, 20, 10, 0, 0, 0, time.UTC)
+	tickerUpdates.publish([]entities.TickerUpdate{
+		{Ticker: "GAZP", Kinds: []string{updateKindConsensus}, Consensus: &consensus},
+		{Ticker: "SBER", Kinds: []string{updateKindPrice}, Price: 250},
+		{ScrapeID: 7, Time: at, Ticker: "SBER", Name: "Sberbank", Kinds: []string{updateKindConsensus},
+			Consensus: &consensus, Price: 250},
+	}, 10)
+
+	change, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.ScrapeId != 7 || change.Name.GetShort() != "SBER" || change.Consensus.GetValue() != consensus ||
+		change.PreviousConsensus != nil || change.Price != 250 || !change.Time.AsTime().Equal(at) {
+		t.Errorf("Recv() = %v, want consensus change of SBER made by scrape 7", change)
+	}
+
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("Recv() after cancel error = %v, want %s", err, codes.Canceled)
+	}
+}
+
+func Test_grpcServer_Shutdown_waits_for_calls(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newGRPCServer(0)
+	served := make(chan error, 1)
+	go func() { served <- server.server.Serve(listener) }()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	stream, err := pb.NewTickerParserClient(conn).WatchConsensusChanges(context.Background(),
+		&pb.WatchConsensusChangesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() error = %v with running call, want %v", err, context.DeadlineExceeded)
+	}
+
+	_ = server.Close()
+	if _, err := stream.Recv(); status.Code(err) == codes.OK {
+		t.Errorf("Recv() after Close error = %v, want the call ended", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve() error = %v after Close, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Serve() did not return after Close")
+	}
+}
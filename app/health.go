@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorNotReady = 1401
+
+	checkPass = "pass"
+	checkFail = "fail"
+)
+
+var (
+	healthzHandlerPath = "/healthz"
+	readyzHandlerPath  = "/readyz"
+)
+
+// healthzHandler serves GET /healthz, it responds while the process is alive.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("new request")
+
+	data := &entities.HealthHTTPData{Status: "ok", Revision: revision}
+	writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(data, nil, 1, r.URL.Path))
+}
+
+// readyzHandler serves GET /readyz, it responds with 503 if any of readiness checks fails.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("new request")
+
+	checks := readinessChecks(getProperties(), clock())
+	data := &entities.ReadinessHTTPData{Ready: true, Checks: checks}
+	var details []entities.HTTPErrorDetails
+	for _, check := range checks {
+		if check.Status == checkFail {
+			data.Ready = false
+			details = append(details, entities.HTTPErrorDetails{
+				Reason:       check.Message,
+				Message:      "readiness check failed",
+				Location:     check.Name,
+				LocationType: "check",
+			})
+		}
+	}
+
+	if data.Ready {
+		writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(data, nil, 1, r.URL.Path))
+		return
+	}
+	httpError := entities.WrapErrors("service is not ready", errorNotReady, details...)
+	writeHTTPResponse(w, http.StatusServiceUnavailable, entities.NewHTTPResponse(data, httpError, 1, r.URL.Path))
+}
+
+// readinessChecks checks the configuration and its last reload, the age of the last successful scrape and circuit breakers
+// of upstream hosts.
+func readinessChecks(properties *Properties, now time.Time) []entities.HealthCheck {
+	return []entities.HealthCheck{
+		configCheck(properties),
+		scrapeCheck(properties, now),
+		upstreamCheck(properties),
+	}
+}
+
+func configCheck(properties *Properties) entities.HealthCheck {
+	check := entities.HealthCheck{Name: "config", Status: checkPass, Message: "configuration is valid"}
+	if problems := validateProperties(properties); len(problems) != 0 {
+		var messages []string
+		for _, problem := range problems {
+			messages = append(messages, problem.String())
+		}
+		check.Status = checkFail
+		check.Message = "configuration is invalid: " + strings.Join(messages, "; ")
+		return check
+	}
+	if err := lastReloadError(); err != "" {
+		check.Status = checkFail
+		check.Message = "last reload failed, previous configuration is kept: " + err
+	}
+	return check
+}
+
+func scrapeCheck(properties *Properties, now time.Time) entities.HealthCheck {
+	check := entities.HealthCheck{Name: "scrape", Status: checkPass}
+	window := time.Duration(properties.Health.ScrapeWindow) * time.Second
+	if window <= 0 {
+		check.Message = "scrape freshness is not checked, health.scrapeWindow is 0"
+		return check
+	}
+
+	at, ok := lastSuccessfulScrape()
+	switch {
+	case !ok:
+		check.Status = checkFail
+		check.Message = "no successful scrape yet"
+	case now.Sub(at) > window:
+		check.Status = checkFail
+		check.Message = fmt.Sprintf("last successful scrape at %s is older than %s", at.Format(time.RFC3339), window)
+	default:
+		check.Message = fmt.Sprintf("last successful scrape at %s", at.Format(time.RFC3339))
+	}
+	return check
+}
+
+func upstreamCheck(properties *Properties) entities.HealthCheck {
+	check := entities.HealthCheck{Name: "upstream", Status: checkPass, Message: "all circuit breakers are closed"}
+	cooldown := time.Duration(properties.Parser.HTTP.CircuitBreaker.Cooldown) * time.Second
+	var open []string
+	for _, status := range breakers.states(cooldown) {
+		if status.State == circuitOpen {
+			open = append(open, fmt.Sprintf("%s until %s", status.Host, status.RetryAt.Format(time.RFC3339)))
+		}
+	}
+	if len(open) != 0 {
+		check.Status = checkFail
+		check.Message = "circuit breaker is open: " + strings.Join(open, ", ")
+	}
+	return check
+}
+
+// lastSuccessfulScrape returns the time of the last scrape of this process, or the last stored one
+// if there was none since the start.
+func lastSuccessfulScrape() (time.Time, bool) {
+	if at, ok := lastScrapeTime(); ok {
+		return at, true
+	}
+	if history == nil {
+		return time.Time{}, false
+	}
+	scrape, err := history.LatestScrape()
+	if err != nil {
+		serverLog.Errorf("cannot read previous scrape from history: %s", err)
+		return time.Time{}, false
+	}
+	if scrape == nil {
+		return time.Time{}, false
+	}
+	return scrape.Time, true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_readinessChecks(t *testing.T) {
+	now := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	savedScrape, savedHistory := lastScrape, history
+	defer func() {
+		lastScrape, history = savedScrape, savedHistory
+		breakers = newBreakerRegistry()
+		setLastReloadError("")
+	}()
+	history = nil
+
+	tests := []struct {
+		name   string
+		modify func(properties *Properties)
+		scrape *scrapeRecord
+		open   bool
+		reload string
+		want   map[string]string
+	}{
+		{
+			name:   "ready",
+			modify: func(properties *Properties) { properties.Health.ScrapeWindow = 3600 },
+			scrape: &scrapeRecord{Time: now.Add(-time.Minute)},
+			want:   map[string]string{"config": checkPass, "scrape": checkPass, "upstream": checkPass},
+		},
+		{
+			name:   "scrape window disabled",
+			modify: func(properties *Properties) {},
+			want:   map[string]string{"config": checkPass, "scrape": checkPass, "upstream": checkPass},
+		},
+		{
+			name: "invalid config and no scrape",
+			modify: func(properties *Properties) {
+				properties.Parser.URL = "www"
+				properties.Health.ScrapeWindow = 3600
+			},
+			want: map[string]string{"config": checkFail, "scrape": checkFail, "upstream": checkPass},
+		},
+		{
+			name:   "failed reload",
+			modify: func(properties *Properties) {},
+			reload: "configuration has 1 problems",
+			want:   map[string]string{"config": checkFail, "scrape": checkPass, "upstream": checkPass},
+		},
+		{
+			name:   "stale scrape and open circuit",
+			modify: func(properties *Properties) { properties.Health.ScrapeWindow = 3600 },
+			scrape: &scrapeRecord{Time: now.Add(-2 * time.Hour)},
+			open:   true,
+			want:   map[string]string{"config": checkPass, "scrape": checkFail, "upstream": checkFail},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			properties := validTestProperties(t)
+			tt.modify(properties)
+			lastScrape = tt.scrape
+			setLastReloadError(tt.reload)
+			breakers = newBreakerRegistry()
+			if tt.open {
+				breakers.get("https://example.com/ticker").record(errors.New("failure"), now, 1)
+			}
+
+			for _, check := range readinessChecks(properties, now) {
+				if check.Status != tt.want[check.Name] {
+					t.Errorf("check %s status = %s (%s), want %s", check.Name, check.Status, check.Message,
+						tt.want[check.Name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorHistoryUnavailable = 1201
+	errorHistoryRequest     = 1202
+	errorHistoryReading     = 1203
+
+	historyDateLayout = "2006-01-02"
+)
+
+var (
+	tickerHistoryPathRegex = regexp.MustCompile(`^/ticker/([^/]+)/history/?$`)
+
+	errHistoryDisabled = errors.New("history storage is disabled, check your configuration parameter: storage.enabled")
+	errNoStoredScrapes = errors.New("no stored scrapes")
+)
+
+// tickerHistoryPath returns short ticker name if the path is /ticker/{short}/history.
+func tickerHistoryPath(path string) (string, bool) {
+	match := tickerHistoryPathRegex.FindStringSubmatch(path)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// tickerHistoryHandler serves GET /ticker/{short}/history?from=&to=&interval= with consensus, price and
+// forecasts count time series. The last month is returned by default, interval keeps the last point
+// of each interval only.
+func tickerHistoryHandler(w http.ResponseWriter, r *http.Request, short string) {
+	requestLogger(r).Info("new request")
+
+	if history == nil {
+		httpError := entities.WrapErrors("history is unavailable", errorHistoryUnavailable, entities.HTTPErrorDetails{
+			Reason:       errHistoryDisabled.Error(),
+			Message:      "history is unavailable",
+			Location:     "storage.enabled",
+			LocationType: "configuration",
+		})
+		writeHTTPResponse(w, http.StatusServiceUnavailable, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	query := r.URL.Query()
+	to := clock()
+	var from time.Time
+	var interval time.Duration
+	var details []entities.HTTPErrorDetails
+
+	if raw := query.Get("to"); raw != "" {
+		value, err := parseHistoryTime(raw)
+		if err != nil {
+			details = append(details, historyParamError("to", err))
+		}
+		to = value
+	}
+	if raw := query.Get("from"); raw != "" {
+		value, err := parseHistoryTime(raw)
+		if err != nil {
+			details = append(details, historyParamError("from", err))
+		}
+		from = value
+	} else {
+		from = to.AddDate(0, -1, 0)
+	}
+	if raw := query.Get("interval"); raw != "" {
+		value, err := parseInterval(raw)
+		if err != nil {
+			details = append(details, historyParamError("interval", err))
+		}
+		interval = value
+	}
+	if len(details) != 0 {
+		httpError := entities.WrapErrors("wrong history request", errorHistoryRequest, details...)
+		writeHTTPResponse(w, http.StatusBadRequest, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	scrapes, err := history.Scrapes(from, to)
+	if err != nil {
+		historyLog.Error(err)
+		httpError := entities.WrapErrors("cannot read history", errorHistoryReading, entities.HTTPErrorDetails{
+			Reason:       err.Error(),
+			Message:      "cannot read history",
+			Location:     getProperties().Storage.Path,
+			LocationType: "file",
+		})
+		writeHTTPResponse(w, http.StatusInternalServerError, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	data := &entities.HistoryHTTPData{
+		Ticker:   short,
+		From:     from,
+		To:       to,
+		Interval: query.Get("interval"),
+		Points:   tickerHistory(scrapes, short, from, interval),
+	}
+	writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(data, nil, 1, r.URL.Path))
+}
+
+func historyParamError(param string, err error) entities.HTTPErrorDetails {
+	return entities.HTTPErrorDetails{
+		Reason:       err.Error(),
+		Message:      "cannot parse parameter " + param,
+		Location:     param,
+		LocationType: "parameter",
+		ExtendedHelp: "use RFC3339 time or " + historyDateLayout + " date for from and to, " +
+			"duration like 1h or 7d for interval",
+	}
+}
+
+// parseHistoryTime accepts RFC3339 time or a date in 2006-01-02 format.
+func parseHistoryTime(raw string) (time.Time, error) {
+	if value, err := time.Parse(time.RFC3339, raw); err == nil {
+		return value, nil
+	}
+	return time.Parse(historyDateLayout, raw)
+}
+
+// parseInterval accepts Go durations and a number of days like 7d.
+func parseInterval(raw string) (time.Duration, error) {
+	var interval time.Duration
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("wrong interval %q: %w", raw, err)
+		}
+		interval = time.Duration(days) * 24 * time.Hour
+	} else {
+		value, err := time.ParseDuration(raw)
+		if err != nil {
+			return 0, err
+		}
+		interval = value
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("interval must be positive: %s", raw)
+	}
+	return interval, nil
+}
+
+// tickerHistory extracts points of the ticker from scrapes sorted by time. With positive interval
+// points are aligned to the intervals starting from given time and the last point of each interval is kept.
+func tickerHistory(scrapes []scrapeRecord, short string, from time.Time, interval time.Duration) []entities.HistoryPoint {
+	points := []entities.HistoryPoint{}
+	for _, scrape := range scrapes {
+		for _, ticker := range scrape.Tickers {
+			if !strings.EqualFold(ticker.Name.Short, short) {
+				continue
+			}
+
+			point := entities.HistoryPoint{
+				Time:           scrape.Time,
+				Price:          ticker.Price,
+				Consensus:      ticker.Consensus,
+				ForecastsCount: len(ticker.Forecasts),
+			}
+			if interval > 0 {
+				point.Time = from.Add(scrape.Time.Sub(from) / interval * interval)
+				if last := len(points) - 1; last >= 0 && points[last].Time.Equal(point.Time) {
+					points[last] = point
+					continue
+				}
+			}
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// loadTickersAsOf is tickersAsOf which reports failures as the HTTP status and the HTTPError: 412 if
+// the storage is disabled, 400 if asOf given in param cannot be parsed, 404 if there is no stored data.
+func loadTickersAsOf(asOf string, param string) (*tickerCollection, int, *entities.HTTPError) {
+	if history == nil {
+		return nil, http.StatusPreconditionFailed, entities.WrapErrors("history is unavailable",
+			errorHistoryUnavailable, entities.HTTPErrorDetails{
+				Reason:       errHistoryDisabled.Error(),
+				Message:      "history is unavailable",
+				Location:     "storage.enabled",
+				LocationType: "configuration",
+			})
+	}
+	if _, err := parseHistoryTime(asOf); err != nil {
+		return nil, http.StatusBadRequest, entities.WrapErrors("wrong request", errorHistoryRequest,
+			historyParamError(param, err))
+	}
+
+	tickers, err := tickersAsOf(asOf)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNoStoredScrapes) {
+			status = http.StatusNotFound
+		}
+		return nil, status, entities.WrapErrors("cannot read history", errorHistoryReading,
+			entities.HTTPErrorDetails{
+				Reason:       err.Error(),
+				Message:      "cannot rebuild tickers",
+				Location:     param,
+				LocationType: "parameter",
+			})
+	}
+	return tickers, http.StatusOK, nil
+}
+
+// tickersAsOf rebuilds consensus as it would have looked at asOf time from stored forecasts,
+// the same filters are applied with the clock pinned to asOf.
+func tickersAsOf(rawAsOf string) (*tickerCollection, error) {
+	if history == nil {
+		return nil, errHistoryDisabled
+	}
+
+	asOf, err := parseHistoryTime(rawAsOf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse asOf value {%s}: %w", rawAsOf, err)
+	}
+
+	scrapes, err := history.Scrapes(asOf.AddDate(0, -forecastActualMonths, 0), asOf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read history: %w", err)
+	}
+	if len(scrapes) == 0 {
+		return nil, fmt.Errorf("%w within %d month before %s", errNoStoredScrapes, forecastActualMonths, asOf)
+	}
+
+	return &tickerCollection{Tickers: filterStored(rebuildTickers(scrapes, asOf), asOf)}, nil
+}
+
+// rebuildTickers takes each ticker from the latest scrape which contains it, so revised forecasts
+// replace their previous versions and withdrawn ones disappear. Forecasts published after asOf are
+// skipped and expected diffs are recalculated against the price of that scrape.
+func rebuildTickers(scrapes []scrapeRecord, asOf time.Time) *[]stockTicker {
+	records := make(map[string]tickerRecord)
+	for _, scrape := range scrapes {
+		for _, record := range scrape.Tickers {
+			records[record.Name.Short] = record
+		}
+	}
+
+	var names []string
+	for short := range records {
+		names = append(names, short)
+	}
+	sort.Strings(names)
+
+	var result []stockTicker
+	for _, short := range names {
+		record := records[short]
+		ticker := stockTicker{Name: record.Name, CurrentPrice: record.Price}
+		var tickerForecasts []forecast
+		for _, forecast := range record.Forecasts {
+			if forecast.Time.After(asOf) {
+				continue
+			}
+			if forecast.Target != 0 && ticker.CurrentPrice != 0 {
+				forecast.ExpectedDiff = (forecast.Target - ticker.CurrentPrice) / ticker.CurrentPrice * 100
+			}
+			tickerForecasts = append(tickerForecasts, forecast)
+		}
+		sort.Slice(tickerForecasts, func(i, j int) bool {
+			return tickerForecasts[i].Time.Before(tickerForecasts[j].Time)
+		})
+		ticker.Forecasts = &tickerForecasts
+		result = append(result, ticker)
+	}
+	return &result
+}
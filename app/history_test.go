@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+func Test_tickerHistoryPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		want   string
+		wantOk bool
+	}{
+		{name: "history path", path: "/ticker/SBER/history", want: "SBER", wantOk: true},
+		{name: "history path with slash", path: "/ticker/SBER/history/", want: "SBER", wantOk: true},
+		{name: "tickers path", path: "/ticker/"},
+		{name: "unknown path", path: "/ticker/SBER/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tickerHistoryPath(tt.path)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("tickerHistoryPath() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_tickerHistory_keeps_last_point_of_interval(t *testing.T) {
+	from := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	var scrapes []scrapeRecord
+	for i := 0; i < 6; i++ {
+		scrapes = append(scrapes, scrapeRecord{
+			Time: from.Add(time.Duration(i) * 8 * time.Hour),
+			Tickers: []tickerRecord{
+				{Name: tickerName{Short: "SBER"}, Price: float64(i)},
+				{Name: tickerName{Short: "GAZP"}, Price: 100},
+			},
+		})
+	}
+
+	got := tickerHistory(scrapes, "sber", from, 24*time.Hour)
+	if len(got) != 2 {
+		t.Fatalf("tickerHistory() got %d points, want 2", len(got))
+	}
+	if got[0].Price != 2 || !got[0].Time.Equal(from) {
+		t.Errorf("tickerHistory() got first point %+v, want price 2 at %s", got[0], from)
+	}
+	if got[1].Price != 5 || !got[1].Time.Equal(from.AddDate(0, 0, 1)) {
+		t.Errorf("tickerHistory() got second point %+v, want price 5 at %s", got[1], from.AddDate(0, 0, 1))
+	}
+}
+
+func Test_rebuildTickers_pins_clock_to_asOf(t *testing.T) {
+	asOf := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	var forecasts []forecast
+	for i := 0; i < 6; i++ {
+		date := asOf.AddDate(0, 0, -i)
+		forecasts = append(forecasts, forecast{ID: forecastID("SBER", "", date), Target: 110, Time: date})
+	}
+	future := asOf.AddDate(0, 0, 1)
+	forecasts = append(forecasts, forecast{ID: forecastID("SBER", "", future), Target: 200, Time: future})
+
+	scrapes := []scrapeRecord{
+		{Time: asOf.AddDate(0, 0, -1), Tickers: []tickerRecord{{Name: tickerName{Short: "SBER"}, Price: 50, Forecasts: forecasts}}},
+		{Time: asOf, Tickers: []tickerRecord{{Name: tickerName{Short: "SBER"}, Price: 100, Forecasts: forecasts}}},
+	}
+
+	tickers := *filterStored(rebuildTickers(scrapes, asOf), asOf)
+	if len(tickers) != 1 {
+		t.Fatalf("filterStored() got %d tickers, want 1", len(tickers))
+	}
+	if len(*tickers[0].Forecasts) != 6 {
+		t.Errorf("rebuildTickers() got %d forecasts, want 6", len(*tickers[0].Forecasts))
+	}
+	if tickers[0].Consensus != 10 {
+		t.Errorf("rebuildTickers() got consensus %f, want 10", tickers[0].Consensus)
+	}
+}
+
+func Test_rebuildTickers_takes_latest_forecasts(t *testing.T) {
+	asOf := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	published := asOf.AddDate(0, 0, -2)
+	original := forecast{ID: forecastID("SBER", "Ivanov", published), Analyst: "Ivanov", Target: 120, Time: published}
+	revised := original
+	revised.Target = 150
+	withdrawn := forecast{ID: forecastID("SBER", "Petrov", published), Analyst: "Petrov", Target: 90, Time: published}
+
+	scrapes := []scrapeRecord{
+		{Time: asOf.AddDate(0, 0, -1), Tickers: []tickerRecord{
+			{Name: tickerName{Short: "SBER"}, Price: 100, Forecasts: []forecast{original, withdrawn}},
+			{Name: tickerName{Short: "GAZP"}, Price: 200},
+		}},
+		{Time: asOf, Tickers: []tickerRecord{{Name: tickerName{Short: "SBER"}, Price: 100, Forecasts: []forecast{revised}}}},
+	}
+
+	tickers := *rebuildTickers(scrapes, asOf)
+	if len(tickers) != 2 || tickers[0].Name.Short != "GAZP" || tickers[1].Name.Short != "SBER" {
+		t.Fatalf("rebuildTickers() = %+v, want GAZP and SBER", tickers)
+	}
+	forecasts := *tickers[1].Forecasts
+	if len(forecasts) != 1 || forecasts[0].Target != 150 || forecasts[0].ExpectedDiff != 50 {
+		t.Errorf("rebuildTickers() got forecasts %+v, want the revised one with diff 50", forecasts)
+	}
+}
+
+func Test_filterStored_does_not_count_dropped(t *testing.T) {
+	at := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	old := at.AddDate(0, -forecastActualMonths-1, 0)
+	newTickers := func() *[]stockTicker {
+		return &[]stockTicker{{Name: tickerName{Short: "SBER"}, Forecasts: &[]forecast{{Time: old}}}}
+	}
+	dropped := func() float64 {
+		tickersDropped.mu.Lock()
+		defer tickersDropped.mu.Unlock()
+		if series, ok := tickersDropped.series["old"]; ok {
+			return series.value
+		}
+		return 0
+	}
+
+	before := dropped()
+	if got := *filterStored(newTickers(), at); len(got) != 0 {
+		t.Fatalf("filterStored() = %+v, want no tickers", got)
+	}
+	if after := dropped(); after != before {
+		t.Errorf("filterStored() counted %f dropped tickers, want none", after-before)
+	}
+	filter(context.Background(), newTickers(), at)
+	if after := dropped(); after != before+1 {
+		t.Errorf("filter() counted %f dropped tickers, want 1", after-before)
+	}
+}
+
+func Test_handler_reports_asOf_errors(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+	savedHistory := history
+	defer func() {
+		history = savedHistory
+	}()
+
+	asOf := time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC)
+	var forecasts []forecast
+	for i := 0; i < 5; i++ {
+		forecasts = append(forecasts, forecast{ID: string(rune('a' + i)), ExpectedDiff: 10, Time: asOf})
+	}
+	scrape := &scrapeRecord{Time: asOf, Tickers: []tickerRecord{{Name: tickerName{Short: "SBER"}, Price: 100, Forecasts: forecasts}}}
+	if err := store.SaveScrape(scrape); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		history    historyStore
+		asOf       string
+		wantStatus int
+		wantCode   int
+		wantFile   string
+	}{
+		{name: "storage disabled", asOf: "2020-03-20", wantStatus: http.StatusPreconditionFailed,
+			wantCode: errorHistoryUnavailable},
+		{name: "wrong asOf", history: store, asOf: "20.03.2020", wantStatus: http.StatusBadRequest,
+			wantCode: errorHistoryRequest},
+		{name: "no stored scrapes", history: store, asOf: "2019-01-01", wantStatus: http.StatusNotFound,
+			wantCode: errorHistoryReading},
+		{name: "stored scrapes", history: store, asOf: "2020-03-21", wantStatus: http.StatusOK},
+		{name: "wrong format", history: store, asOf: "2020-03-21&format=xml", wantStatus: http.StatusBadRequest,
+			wantCode: errorTickerRequest},
+		{name: "export", history: store, asOf: "2020-03-21&format=csv", wantStatus: http.StatusOK,
+			wantFile: "tickers-2020-03-21.csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history = tt.history
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest(http.MethodGet, "/ticker/?asOf="+tt.asOf, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("handler() status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if disposition := recorder.Header().Get("Content-Disposition"); !strings.Contains(disposition, tt.wantFile) {
+				t.Errorf("handler() Content-Disposition = %q, want file %s", disposition, tt.wantFile)
+			}
+			if tt.wantCode == 0 {
+				return
+			}
+			var response entities.HTTPResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("handler() wrote wrong body %s: %v", recorder.Body, err)
+			}
+			if response.Error == nil || response.Error.Code != tt.wantCode {
+				t.Errorf("handler() error = %+v, want code %d", response.Error, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// httpCache stores upstream responses having ETag or Last-Modified validators on disk, one file per URL.
+// Stored validators are sent with the next request of the URL, the stored body is reused on 304.
+type httpCache struct {
+	dir string
+}
+
+// cacheEntry is the stored response, the file is named by hash of the URL.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	ContentType  string    `json:"contentType,omitempty"`
+	StoredAt     time.Time `json:"storedAt"`
+	Body         []byte    `json:"body"`
+}
+
+func newHTTPCache(dir string) (*httpCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create http cache directory (%s): %w", dir, err)
+	}
+	return &httpCache{dir: dir}, nil
+}
+
+func (ptr *httpCache) file(url string) string {
+	hash := sha1.Sum([]byte(url))
+	return filepath.Join(ptr.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// get returns the stored entry of the url, missed and unreadable entries are reported as absent.
+func (ptr *httpCache) get(url string) (*cacheEntry, bool) {
+	data, err := ioutil.ReadFile(ptr.file(url))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// put stores the body of the response if it has validators. The file is replaced atomically, so
+// concurrent readers see either the previous or the new entry.
+func (ptr *httpCache) put(url string, header http.Header, body []byte) error {
+	entry := cacheEntry{
+		URL:          url,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		ContentType:  header.Get("Content-Type"),
+		StoredAt:     time.Now(),
+		Body:         body,
+	}
+	if entry.ETag == "" && entry.LastModified == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(ptr.dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), ptr.file(url))
+}
+
+// setValidators adds conditional headers of the entry to the request.
+func (ptr *cacheEntry) setValidators(request *http.Request) {
+	if ptr.ETag != "" {
+		request.Header.Set("If-None-Match", ptr.ETag)
+	}
+	if ptr.LastModified != "" {
+		request.Header.Set("If-Modified-Since", ptr.LastModified)
+	}
+}
+
+// response builds 200 response with the stored body.
+func (ptr *cacheEntry) response() *http.Response {
+	header := make(http.Header)
+	if ptr.ContentType != "" {
+		header.Set("Content-Type", ptr.ContentType)
+	}
+	if ptr.ETag != "" {
+		header.Set("ETag", ptr.ETag)
+	}
+	if ptr.LastModified != "" {
+		header.Set("Last-Modified", ptr.LastModified)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(ptr.Body)),
+		ContentLength: int64(len(ptr.Body)),
+	}
+}
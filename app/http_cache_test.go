@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_upstreamClient_get_revalidates_cached_response(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	client := newTestUpstreamClient(t, &sleeps)
+	client.cache, _ = newHTTPCache(dir)
+
+	for i := 0; i < 2; i++ {
+		response, err := client.get(context.Background(), server.URL, responseLimits{contentTypes: htmlContentTypes})
+		if err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if string(body) != "page" || response.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("get() #%d body = %q, content type = %q", i, body, response.Header.Get("Content-Type"))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("get() made %d calls, want 2", calls)
+	}
+}
+
+func Test_upstreamClient_get_does_not_cache_rejected_response(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	defer func() { breakers = newBreakerRegistry() }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr interface{}
+	}{
+		{name: "oversized body", path: "/html", wantErr: &bodyTooLargeError{}},
+		{name: "unexpected content type", path: "/json", wantErr: &contentTypeError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sleeps []time.Duration
+			client := newTestUpstreamClient(t, &sleeps)
+			client.cache, _ = newHTTPCache(dir)
+
+			url := server.URL + tt.path
+			limits := responseLimits{limit: 10, parameter: "parser.http.limits.page", contentTypes: htmlContentTypes}
+			_, err := client.get(context.Background(), url, limits)
+			if reflect.TypeOf(err) != reflect.TypeOf(tt.wantErr) {
+				t.Fatalf("get() error = %v, want %T", err, tt.wantErr)
+			}
+			if len(sleeps) != 0 {
+				t.Errorf("get() retried rejected response %d times", len(sleeps))
+			}
+			if _, ok := client.cache.get(url); ok {
+				t.Errorf("get() cached rejected response")
+			}
+		})
+	}
+}
+
+func Test_httpCache_put_skips_responses_without_validators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cache, _ := newHTTPCache(dir)
+	if err := cache.put("http://host/a", http.Header{}, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get("http://host/a"); ok {
+		t.Errorf("get() found response without validators")
+	}
+
+	header := http.Header{"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"}}
+	if err := cache.put("http://host/b", header, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := cache.get("http://host/b"); !ok || string(entry.Body) != "b" {
+		t.Errorf("get() = %v, %v, want stored body", entry, ok)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	upstream   *upstreamClient
+	upstreamMu sync.Mutex
+)
+
+// httpStatusError is returned when the upstream responds with unexpected status code. The message
+// shows the URL without the password, it reaches responses and /status.
+type httpStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (ptr *httpStatusError) Error() string {
+	return fmt.Sprintf("cannot get document (%s): status code is %d", redactString(redactURL, ptr.URL), ptr.StatusCode)
+}
+
+// upstreamClient is the HTTP client shared by catalog and pages parsers. It sets identity headers
+// and retries 429 and 5xx responses and network errors with jittered exponential backoff. Requests
+// to a host fail fast while its circuit breaker is open.
+type upstreamClient struct {
+	client           *http.Client
+	userAgent        string
+	headers          http.Header
+	retries          int
+	backoff          time.Duration
+	maxBackoff       time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	cache            *httpCache
+	sleep            func(ctx context.Context, duration time.Duration) error
+}
+
+// getUpstreamClient creates the client from properties if needed and gives pointer to it.
+func getUpstreamClient() (*upstreamClient, error) {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	if upstream == nil {
+		client, err := newUpstreamClient(getProperties())
+		if err != nil {
+			return nil, err
+		}
+		upstream = client
+	}
+	return upstream, nil
+}
+
+func newUpstreamClient(properties *Properties) (*upstreamClient, error) {
+	config := properties.Parser.HTTP
+
+	headers, err := parseHeaders(config.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout := time.Duration(config.ConnectTimeout) * time.Second
+	readTimeout := time.Duration(config.ReadTimeout) * time.Second
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse proxy url (%s): %w", redactString(redactURL, config.Proxy), err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var cache *httpCache
+	if config.Cache.Enabled {
+		if cache, err = newHTTPCache(config.Cache.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	return &upstreamClient{
+		// the whole exchange including reading of the body must fit both timeouts
+		client:     &http.Client{Transport: transport, Timeout: connectTimeout + readTimeout},
+		userAgent:  config.UserAgent,
+		headers:    headers,
+		retries:    int(config.Retries),
+		backoff:    time.Duration(config.Backoff) * time.Second,
+		maxBackoff: time.Duration(config.MaxBackoff) * time.Second,
+
+		breakerThreshold: int(config.CircuitBreaker.Threshold),
+		breakerCooldown:  time.Duration(config.CircuitBreaker.Cooldown) * time.Second,
+		cache:            cache,
+
+		sleep: sleepContext,
+	}, nil
+}
+
+// parseHeaders parses "Name: value" pairs separated by new lines.
+func parseHeaders(raw string) (http.Header, error) {
+	headers := make(http.Header)
+	for i, line := range strings.Split(raw, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("wrong header on line %d, expected \"Name: value\"", i+1)
+		}
+		headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return headers, nil
+}
+
+// get requests the url and returns response with status code 200. Returns circuitOpenError without
+// requesting if the circuit breaker of the host is open. Cancelled requests do not affect the breaker.
+// Responses are cached only if they pass the limits.
+func (ptr *upstreamClient) get(ctx context.Context, url string, limits responseLimits) (*http.Response, error) {
+	breaker := breakers.get(url)
+	if err := breaker.allow(time.Now(), ptr.breakerCooldown); err != nil {
+		upstreamResponses.add(1, "circuit_open")
+		return nil, err
+	}
+
+	response, err := ptr.fetch(ctx, url, limits)
+	if ctx.Err() != nil {
+		breaker.cancel()
+		return response, err
+	}
+	breaker.record(upstreamFailure(err), time.Now(), ptr.breakerThreshold)
+	return response, err
+}
+
+// fetch requests the url and returns response with status code 200. Network errors, 429 and 5xx responses
+// are retried, Retry-After header is honored while it is not longer than maxBackoff. If the cache has
+// the url, the request is conditional and 304 response is replaced with the cached one. Retries stop
+// when ctx is cancelled. Responses rejected by the limits are not retried.
+func (ptr *upstreamClient) fetch(ctx context.Context, url string, limits responseLimits) (*http.Response, error) {
+	var cached *cacheEntry
+	if ptr.cache != nil {
+		cached, _ = ptr.cache.get(url)
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := ptr.do(ctx, url, cached)
+		if err == nil && response.StatusCode == http.StatusNotModified && cached != nil {
+			discardBody(response)
+			logger(ctx, upstreamLog).WithField("url", url).Debugf("%s is not modified, cached body is used", url)
+			return cached.response(), nil
+		}
+		if err == nil && response.StatusCode == http.StatusOK {
+			if response, err = ptr.store(ctx, url, response, limits); err == nil {
+				return response, nil
+			}
+			if rejectedResponseDetails(err) != nil {
+				return nil, err
+			}
+		}
+
+		wait := ptr.backoffFor(attempt)
+		if err == nil {
+			discardBody(response)
+			err = &httpStatusError{URL: url, StatusCode: response.StatusCode}
+			if !retryableStatus(response.StatusCode) {
+				return nil, err
+			}
+			if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+				if retryAfter > ptr.maxBackoff {
+					return nil, fmt.Errorf("%w, retry after %s is too long", err, retryAfter)
+				}
+				wait = retryAfter
+			}
+		}
+
+		if attempt >= ptr.retries || ctx.Err() != nil {
+			return nil, err
+		}
+		if err := ptr.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (ptr *upstreamClient) do(ctx context.Context, url string, cached *cacheEntry) (*http.Response, error) {
+	ctx, span := startSpan(ctx, "HTTP GET", spanKindClient)
+	defer span.finish()
+	span.setAttribute("http.method", http.MethodGet)
+	span.setAttribute("http.url", url)
+	span.setAttribute("http.conditional", cached != nil)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		span.recordError(err)
+		return nil, err
+	}
+	for name, values := range ptr.headers {
+		request.Header[name] = values
+	}
+	if ptr.userAgent != "" {
+		request.Header.Set("User-Agent", ptr.userAgent)
+	}
+	if cached != nil {
+		cached.setValidators(request)
+	}
+
+	response, err := ptr.client.Do(request)
+	if err != nil {
+		upstreamResponses.add(1, "error")
+		span.recordError(err)
+	} else {
+		upstreamResponses.add(1, strconv.Itoa(response.StatusCode))
+		span.setAttribute("http.status_code", response.StatusCode)
+		if response.StatusCode >= http.StatusBadRequest {
+			span.recordError(&httpStatusError{URL: url, StatusCode: response.StatusCode})
+		}
+	}
+	return response, err
+}
+
+// store saves the response to the cache if it is enabled, the body is read to memory then and
+// the returned response reads it from there. Responses with unexpected content type or with body
+// longer than the limit are rejected before they are read further or cached.
+func (ptr *upstreamClient) store(ctx context.Context, url string, response *http.Response,
+	limits responseLimits) (*http.Response, error) {
+	if ptr.cache == nil || (response.Header.Get("ETag") == "" && response.Header.Get("Last-Modified") == "") {
+		return response, nil
+	}
+
+	if err := checkContentType(url, response, limits.contentTypes); err != nil {
+		discardBody(response)
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(limitBody(url, response, limits.limit, limits.parameter))
+	_ = response.Body.Close()
+	if _, ok := err.(*bodyTooLargeError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body (%s): %w", url, err)
+	}
+	if err := ptr.cache.put(url, response.Header, body); err != nil {
+		logger(ctx, upstreamLog).WithField("url", url).Warnf("cannot cache response of %s: %s", url, err)
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
+
+// backoffFor returns jittered exponential backoff for the attempt: a random duration between half and
+// full of backoff * 2^attempt, but not longer than maxBackoff.
+func (ptr *upstreamClient) backoffFor(attempt int) time.Duration {
+	backoff := ptr.backoff << uint(attempt)
+	if backoff > ptr.maxBackoff || backoff <= 0 {
+		backoff = ptr.maxBackoff
+	}
+	half := int64(backoff / 2)
+	if half <= 0 {
+		return backoff
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// sleepContext waits for the duration, returns the error of ctx if it is cancelled earlier.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// parseRetryAfter parses Retry-After header given in seconds or as HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// discardBody reads the rest of the body to reuse the connection and closes it.
+func discardBody(response *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestUpstreamClient(t *testing.T, sleeps *[]time.Duration) *upstreamClient {
+	properties := &Properties{}
+	properties.Parser.HTTP.ConnectTimeout = 1
+	properties.Parser.HTTP.ReadTimeout = 1
+	properties.Parser.HTTP.Retries = 2
+	properties.Parser.HTTP.Backoff = 1
+	properties.Parser.HTTP.MaxBackoff = 10
+	properties.Parser.HTTP.UserAgent = "test-agent"
+	properties.Parser.HTTP.Headers = "Accept-Language: ru\nX-Custom: a: b"
+
+	client, err := newUpstreamClient(properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.sleep = func(_ context.Context, duration time.Duration) error {
+		*sleeps = append(*sleeps, duration)
+		return nil
+	}
+	return client
+}
+
+func Test_upstreamClient_get_retries_and_honors_retry_after(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("User-Agent") != "test-agent" || r.Header.Get("X-Custom") != "a: b" {
+			t.Errorf("get() sent headers %v", r.Header)
+		}
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	response, err := newTestUpstreamClient(t, &sleeps).get(context.Background(), server.URL, responseLimits{})
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	_ = response.Body.Close()
+
+	if calls != 3 || len(sleeps) != 2 {
+		t.Fatalf("get() made %d calls and %d sleeps, want 3 and 2", calls, len(sleeps))
+	}
+	if sleeps[0] != 3*time.Second {
+		t.Errorf("get() slept %s, want Retry-After 3s", sleeps[0])
+	}
+	if sleeps[1] < time.Second || sleeps[1] > 2*time.Second {
+		t.Errorf("get() slept %s, want jittered backoff between 1s and 2s", sleeps[1])
+	}
+}
+
+func Test_upstreamClient_get_does_not_retry_client_errors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	_, err := newTestUpstreamClient(t, &sleeps).get(context.Background(), server.URL, responseLimits{})
+	statusError, ok := err.(*httpStatusError)
+	if !ok || statusError.StatusCode != http.StatusNotFound {
+		t.Errorf("get() error = %v, want httpStatusError with 404", err)
+	}
+	if calls != 1 {
+		t.Errorf("get() made %d calls, want 1", calls)
+	}
+}
+
+func Test_upstreamClient_get_hides_password_in_errors(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name   string
+		server *httptest.Server
+	}{
+		{name: "status code", server: unavailable},
+		{name: "network error", server: unreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakers = newBreakerRegistry()
+			defer func() { breakers = newBreakerRegistry() }()
+			url := strings.Replace(tt.server.URL, "http://", "http://user:secret@", 1)
+
+			var sleeps []time.Duration
+			_, err := newTestUpstreamClient(t, &sleeps).get(context.Background(), url, responseLimits{})
+			if err == nil || strings.Contains(err.Error(), "secret") {
+				t.Errorf("get() error = %v, want error without the password", err)
+			}
+			if status := breakers.get(url).status(time.Minute); strings.Contains(status.LastError, "secret") {
+				t.Errorf("breaker last error = %s, want it without the password", status.LastError)
+			}
+		})
+	}
+}
+
+func Test_upstreamClient_get_stops_retrying_when_cancelled(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer func() { breakers = newBreakerRegistry() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var sleeps []time.Duration
+	client := newTestUpstreamClient(t, &sleeps)
+	client.breakerThreshold = 1
+	client.sleep = func(ctx context.Context, duration time.Duration) error {
+		cancel()
+		return sleepContext(ctx, duration)
+	}
+
+	if _, err := client.get(ctx, server.URL, responseLimits{}); err != context.Canceled {
+		t.Errorf("get() error = %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("get() made %d calls, want 1", calls)
+	}
+	if state := breakers.get(server.URL).status(0).State; state != circuitClosed {
+		t.Errorf("breaker state = %s after cancelled request, want %s", state, circuitClosed)
+	}
+}
+
+func Test_newUpstreamClient_fails_with_wrong_proxy(t *testing.T) {
+	properties := &Properties{}
+	properties.Parser.HTTP.Proxy = "ftp://proxy:21"
+	if _, err := newUpstreamClient(properties); err == nil {
+		t.Errorf("newUpstreamClient() error = %v, wantErr %v", err, true)
+	}
+}
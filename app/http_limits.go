@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"ticker-parser/app/entities"
+)
+
+// responseRejectedDomain marks HTTPErrorDetails caused by upstream response which violates the limits.
+const responseRejectedDomain = "response"
+
+var (
+	jsonContentTypes = []string{"application/json", "text/json"}
+	htmlContentTypes = []string{"text/html", "application/xhtml+xml"}
+)
+
+// bodyTooLargeError is returned when the response body is longer than the limit set by the parameter.
+type bodyTooLargeError struct {
+	URL       string
+	Limit     int64
+	Parameter string
+}
+
+func (ptr *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("response body of %s exceeds the limit of %d bytes", redactString(redactURL, ptr.URL), ptr.Limit)
+}
+
+// contentTypeError is returned when the response has unexpected content type.
+type contentTypeError struct {
+	URL         string
+	ContentType string
+	Expected    []string
+}
+
+func (ptr *contentTypeError) Error() string {
+	return fmt.Sprintf("response of %s has content type %q, expected one of %v", redactString(redactURL, ptr.URL),
+		ptr.ContentType, ptr.Expected)
+}
+
+// responseLimits are the checks of upstream responses of an endpoint: the body size limit set by
+// the parameter, non-positive limit means no limit, and accepted media types.
+type responseLimits struct {
+	limit        int64
+	parameter    string
+	contentTypes []string
+}
+
+// limitedBody reads the body and fails with bodyTooLargeError as soon as more than limit bytes are read,
+// so the body is never loaded further than the limit.
+type limitedBody struct {
+	reader io.Reader
+	read   int64
+	err    *bodyTooLargeError
+}
+
+// limitBody returns the reader of the response body limited by the parameter value, non-positive limit
+// means no limit. Declared Content-Length is checked before reading.
+func limitBody(url string, response *http.Response, limit int64, parameter string) io.Reader {
+	if limit <= 0 {
+		return response.Body
+	}
+	err := &bodyTooLargeError{URL: url, Limit: limit, Parameter: parameter}
+	if response.ContentLength > limit {
+		return &limitedBody{reader: response.Body, read: response.ContentLength, err: err}
+	}
+	return &limitedBody{reader: io.LimitReader(response.Body, limit+1), err: err}
+}
+
+func (ptr *limitedBody) Read(p []byte) (int, error) {
+	if ptr.read > ptr.err.Limit {
+		return 0, ptr.err
+	}
+	n, err := ptr.reader.Read(p)
+	ptr.read += int64(n)
+	if ptr.read > ptr.err.Limit {
+		return n - int(ptr.read-ptr.err.Limit), ptr.err
+	}
+	return n, err
+}
+
+// checkContentType returns contentTypeError if the response declares a media type not in the expected
+// list. Responses without Content-Type are accepted.
+func checkContentType(url string, response *http.Response, expected []string) error {
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, allowed := range expected {
+			if mediaType == allowed {
+				return nil
+			}
+		}
+	}
+	return &contentTypeError{URL: url, ContentType: contentType, Expected: expected}
+}
+
+// rejectedResponseDetails describes bodyTooLargeError and contentTypeError, returns nil for other errors.
+func rejectedResponseDetails(err error) *entities.HTTPErrorDetails {
+	switch rejected := err.(type) {
+	case *bodyTooLargeError:
+		return &entities.HTTPErrorDetails{
+			Domain:       responseRejectedDomain,
+			Reason:       rejected.Error(),
+			Message:      "upstream response is too large",
+			Location:     redactString(redactURL, rejected.URL),
+			LocationType: "url",
+			ExtendedHelp: "check your configuration parameter: " + rejected.Parameter + "\n" +
+				"current value: " + strconv.FormatInt(rejected.Limit, 10),
+		}
+	case *contentTypeError:
+		return &entities.HTTPErrorDetails{
+			Domain:       responseRejectedDomain,
+			Reason:       rejected.Error(),
+			Message:      "upstream response has unexpected content type",
+			Location:     redactString(redactURL, rejected.URL),
+			LocationType: "url",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_limitBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		limit         int64
+		wantErr       bool
+	}{
+		{name: "within limit", body: "12345", contentLength: -1, limit: 5},
+		{name: "over limit", body: "123456", contentLength: -1, limit: 5, wantErr: true},
+		{name: "declared length over limit", body: "1", contentLength: 100, limit: 5, wantErr: true},
+		{name: "no limit", body: "123456", contentLength: -1, limit: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &http.Response{
+				Body:          ioutil.NopCloser(strings.NewReader(tt.body)),
+				ContentLength: tt.contentLength,
+			}
+			got, err := ioutil.ReadAll(limitBody("url", response, tt.limit, "parameter"))
+			if _, ok := err.(*bodyTooLargeError); ok != tt.wantErr {
+				t.Fatalf("limitBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.limit > 0 && int64(len(got)) > tt.limit {
+				t.Errorf("limitBody() read %d bytes over the limit %d", len(got), tt.limit)
+			}
+		})
+	}
+}
+
+func Test_checkContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    []string
+		wantErr     bool
+	}{
+		{name: "json", contentType: "application/json; charset=utf-8", expected: jsonContentTypes},
+		{name: "html as json", contentType: "text/html", expected: jsonContentTypes, wantErr: true},
+		{name: "html", contentType: "text/html; charset=windows-1251", expected: htmlContentTypes},
+		{name: "missing", contentType: "", expected: htmlContentTypes},
+		{name: "malformed", contentType: "text/html;;", expected: htmlContentTypes, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &http.Response{Header: http.Header{}}
+			if tt.contentType != "" {
+				response.Header.Set("Content-Type", tt.contentType)
+			}
+			if err := checkContentType("url", response, tt.expected); (err != nil) != tt.wantErr {
+				t.Errorf("checkContentType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
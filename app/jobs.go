@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorJobRequest     = 1101
+	errorJobNotFound    = 1102
+	errorJobNotFinished = 1103
+
+	jobTypeCatalog = "catalog"
+	jobTypeTicker  = "ticker"
+
+	jobStatusRunning   = "running"
+	jobStatusDone      = "done"
+	jobStatusFailed    = "failed"
+	jobStatusCancelled = "cancelled"
+)
+
+var (
+	jobsHandlerPath = "/jobs"
+
+	jobs = newJobStore()
+)
+
+// scrapeJob is an asynchronous catalog or ticker scrape started by POST /jobs.
+type scrapeJob struct {
+	mu       sync.Mutex
+	id       string
+	typ      string
+	status   string
+	created  time.Time
+	finished *time.Time
+	progress *scrapeProgress
+	result   *entities.HTTPResponse
+	cancel   context.CancelFunc
+}
+
+type jobRequest struct {
+	Type string `json:"type"`
+}
+
+func (ptr *scrapeJob) httpData() *entities.JobHTTPData {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	return &entities.JobHTTPData{
+		ID:       ptr.id,
+		Type:     ptr.typ,
+		Status:   ptr.status,
+		Created:  ptr.created,
+		Finished: ptr.finished,
+		Progress: ptr.progress.snapshot(),
+	}
+}
+
+// finish stores the result of the job unless the job has been cancelled already.
+func (ptr *scrapeJob) finish(result *entities.HTTPResponse) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	if ptr.status != jobStatusRunning {
+		return
+	}
+	now := time.Now()
+	ptr.finished = &now
+	ptr.result = result
+	ptr.status = jobStatusDone
+	if result.Error != nil {
+		ptr.status = jobStatusFailed
+	}
+}
+
+// stop cancels running job, returns false if the job is finished already.
+func (ptr *scrapeJob) stop() bool {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	if ptr.status != jobStatusRunning {
+		return false
+	}
+	ptr.cancel()
+	now := time.Now()
+	ptr.finished = &now
+	ptr.status = jobStatusCancelled
+	return true
+}
+
+// expired reports if the job finished earlier than ttl ago.
+func (ptr *scrapeJob) expired(now time.Time, ttl time.Duration) bool {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	return ptr.finished != nil && now.Sub(*ptr.finished) > ttl
+}
+
+type jobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*scrapeJob
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*scrapeJob)}
+}
+
+// start creates a job of given type and runs it in a new goroutine.
+func (ptr *jobStore) start(typ string) (*scrapeJob, error) {
+	var run func(ctx context.Context, progress *scrapeProgress) *entities.HTTPResponse
+	switch typ {
+	case jobTypeCatalog:
+		run = runCatalogJob
+	case jobTypeTicker:
+		run = runTickerJob
+	default:
+		return nil, fmt.Errorf("unknown job type %q, expected %s or %s", typ, jobTypeCatalog, jobTypeTicker)
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(appContext)
+	job := &scrapeJob{
+		id:       id,
+		typ:      typ,
+		status:   jobStatusRunning,
+		created:  time.Now(),
+		progress: &scrapeProgress{},
+		cancel:   cancel,
+	}
+
+	ptr.mu.Lock()
+	ptr.expire()
+	ptr.jobs[id] = job
+	ptr.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		ctx := withLogFields(ctx, log.Fields{"job_id": job.id, "job_type": job.typ})
+		logger(ctx, schedulerLog).Infof("job %s (%s) started", job.id, job.typ)
+		job.finish(run(ctx, job.progress))
+		logger(ctx, schedulerLog).Infof("job %s (%s) finished", job.id, job.typ)
+	}()
+
+	return job, nil
+}
+
+func (ptr *jobStore) get(id string) *scrapeJob {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.expire()
+	return ptr.jobs[id]
+}
+
+// expire removes finished jobs which are older than configured TTL, must be called under the lock.
+func (ptr *jobStore) expire() {
+	ttl := time.Duration(getProperties().Jobs.TTL) * time.Second
+	now := time.Now()
+	for id, job := range ptr.jobs {
+		if job.expired(now, ttl) {
+			delete(ptr.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("cannot generate job id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func runCatalogJob(ctx context.Context, progress *scrapeProgress) *entities.HTTPResponse {
+	catalogHTTPData, httpError := fetchCatalog(ctx, progress)
+	return entities.NewHTTPResponse(catalogHTTPData, httpError, 1, catalogGetHandlerPath)
+}
+
+// runTickerJob scrapes tickers on its own instead of joining the shared runTheJob flight: the job reports
+// the progress of its scrape and DELETE /jobs/{id} must stop this scrape only, a shared one has neither.
+// The scrape is recorded and checked by alert rules as any other, see finishScrape.
+func runTickerJob(ctx context.Context, progress *scrapeProgress) *entities.HTTPResponse {
+	tickers, _, err := scrapeTickers(ctx, progress)
+	if err != nil {
+		return entities.NewHTTPResponse(nil, wrapTickerError(err), 1, "/ticker/")
+	}
+	return entities.NewHTTPResponse(tickers, nil, 1, "/ticker/")
+}
+
+// jobsHandler starts new jobs: POST /jobs {"type": "catalog"|"ticker"}.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("new request")
+
+	if r.Method != http.MethodPost {
+		writeHTTPResponse(w, http.StatusMethodNotAllowed, entities.NewHTTPResponse(nil,
+			jobError("method not allowed", r.Method, "method", "use POST to start a job"), 1, r.URL.Path))
+		return
+	}
+
+	var request jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeHTTPResponse(w, http.StatusBadRequest, entities.NewHTTPResponse(nil,
+			jobError("cannot parse request body", err.Error(), "body", `expected body: {"type": "catalog"}`), 1, r.URL.Path))
+		return
+	}
+
+	job, err := jobs.start(request.Type)
+	if err != nil {
+		writeHTTPResponse(w, http.StatusBadRequest, entities.NewHTTPResponse(nil,
+			jobError("cannot start job", err.Error(), "type", ""), 1, r.URL.Path))
+		return
+	}
+
+	writeHTTPResponse(w, http.StatusAccepted, entities.NewHTTPResponse(job.httpData(), nil, 1, r.URL.Path))
+}
+
+// jobHandler serves GET /jobs/{id}, GET /jobs/{id}/result and DELETE /jobs/{id}.
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("new request")
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, jobsHandlerPath+"/"), "/")
+	id := parts[0]
+	wantResult := len(parts) == 2 && parts[1] == "result"
+	if len(parts) > 2 || (len(parts) == 2 && !wantResult) {
+		http.NotFound(w, r)
+		return
+	}
+
+	job := jobs.get(id)
+	if job == nil {
+		httpError := entities.WrapErrors("job not found", errorJobNotFound, entities.HTTPErrorDetails{
+			Reason:       "job does not exist or has expired",
+			Message:      "job not found",
+			Location:     id,
+			LocationType: "id",
+		})
+		writeHTTPResponse(w, http.StatusNotFound, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodDelete && !wantResult:
+		if !job.stop() {
+			writeHTTPResponse(w, http.StatusConflict, entities.NewHTTPResponse(job.httpData(),
+				jobError("job is not running", job.httpData().Status, "status", ""), 1, r.URL.Path))
+			return
+		}
+		writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(job.httpData(), nil, 1, r.URL.Path))
+
+	case r.Method == http.MethodGet && wantResult:
+		job.mu.Lock()
+		result := job.result
+		job.mu.Unlock()
+		if result == nil {
+			httpError := entities.WrapErrors("job has no result", errorJobNotFinished, entities.HTTPErrorDetails{
+				Reason:       "job is " + job.httpData().Status,
+				Message:      "job has no result",
+				Location:     id,
+				LocationType: "id",
+				ExtendedHelp: "check job status at " + jobsHandlerPath + "/" + id,
+			})
+			writeHTTPResponse(w, http.StatusConflict, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+			return
+		}
+		writeHTTPResponse(w, http.StatusOK, result)
+
+	case r.Method == http.MethodGet:
+		writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(job.httpData(), nil, 1, r.URL.Path))
+
+	default:
+		writeHTTPResponse(w, http.StatusMethodNotAllowed, entities.NewHTTPResponse(nil,
+			jobError("method not allowed", r.Method, "method", ""), 1, r.URL.Path))
+	}
+}
+
+func jobError(message string, reason string, location string, help string) *entities.HTTPError {
+	return entities.WrapErrors(message, errorJobRequest, entities.HTTPErrorDetails{
+		Reason:       reason,
+		Message:      message,
+		Location:     location,
+		LocationType: "request",
+		ExtendedHelp: help,
+	})
+}
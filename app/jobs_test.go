@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+type jobTestResponse struct {
+	Data  json.RawMessage     `json:"data"`
+	Error *entities.HTTPError `json:"error"`
+}
+
+// useJobsTestCatalog points catalog jobs to given handler, the returned function restores the settings.
+func useJobsTestCatalog(t *testing.T, handler http.HandlerFunc) func() {
+	server := httptest.NewServer(handler)
+
+	properties := validTestProperties(t)
+	var sleeps []time.Duration
+	propsMu.Lock()
+	saved := props
+	props = properties
+	propsMu.Unlock()
+	backupClient, backupUrl, backupSize, backupJobs := upstream, catalogBaseUrl, catalogPageSize, jobs
+	upstream, catalogBaseUrl, catalogPageSize, jobs = newTestUpstreamClient(t, &sleeps), server.URL, 2, newJobStore()
+
+	return func() {
+		server.Close()
+		upstream, catalogBaseUrl, catalogPageSize, jobs = backupClient, backupUrl, backupSize, backupJobs
+		propsMu.Lock()
+		props = saved
+		propsMu.Unlock()
+	}
+}
+
+func doJobRequest(t *testing.T, method string, path string, body string) (int, jobTestResponse) {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	if path == jobsHandlerPath {
+		jobsHandler(recorder, request)
+	} else {
+		jobHandler(recorder, request)
+	}
+
+	var response jobTestResponse
+	if recorder.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s %s wrote wrong body %s: %v", method, path, recorder.Body, err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func startTestJob(t *testing.T) entities.JobHTTPData {
+	code, response := doJobRequest(t, http.MethodPost, jobsHandlerPath, `{"type": "catalog"}`)
+	if code != http.StatusAccepted || response.Error != nil {
+		t.Fatalf("POST %s = %d %+v, want %d", jobsHandlerPath, code, response.Error, http.StatusAccepted)
+	}
+	var job entities.JobHTTPData
+	if err := json.Unmarshal(response.Data, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Status != jobStatusRunning {
+		t.Fatalf("POST %s started job %+v, want running job with ID", jobsHandlerPath, job)
+	}
+	return job
+}
+
+func waitTestJob(t *testing.T, id string) entities.JobHTTPData {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, response := doJobRequest(t, http.MethodGet, jobsHandlerPath+"/"+id, "")
+		if code != http.StatusOK {
+			t.Fatalf("GET %s/%s = %d %+v, want %d", jobsHandlerPath, id, code, response.Error, http.StatusOK)
+		}
+		var job entities.JobHTTPData
+		if err := json.Unmarshal(response.Data, &job); err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != jobStatusRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still running", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_jobHandler_returns_result_of_finished_job(t *testing.T) {
+	defer useJobsTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("offset") == "0" {
+			_, _ = w.Write([]byte(`[{"title": "A"}, {"title": "B"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"title": "C"}]`))
+	})()
+
+	job := startTestJob(t)
+	if finished := waitTestJob(t, job.ID); finished.Status != jobStatusDone || finished.Finished == nil {
+		t.Fatalf("job finished as %+v, want %s", finished, jobStatusDone)
+	}
+
+	code, response := doJobRequest(t, http.MethodGet, jobsHandlerPath+"/"+job.ID+"/result", "")
+	if code != http.StatusOK || response.Error != nil {
+		t.Fatalf("GET result = %d %+v, want %d", code, response.Error, http.StatusOK)
+	}
+	var catalog entities.CatalogHTTPData
+	if err := json.Unmarshal(response.Data, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if catalog.ItemsCount != 3 {
+		t.Errorf("GET result returned %d items, want 3", catalog.ItemsCount)
+	}
+
+	if code, _ := doJobRequest(t, http.MethodDelete, jobsHandlerPath+"/"+job.ID, ""); code != http.StatusConflict {
+		t.Errorf("DELETE of finished job = %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func Test_jobHandler_cancels_running_job(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	cancelled := make(chan struct{}, 1)
+	defer useJobsTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-release:
+		}
+	})()
+	defer close(release)
+
+	job := startTestJob(t)
+	<-requested
+
+	code, response := doJobRequest(t, http.MethodDelete, jobsHandlerPath+"/"+job.ID, "")
+	if code != http.StatusOK || response.Error != nil {
+		t.Fatalf("DELETE = %d %+v, want %d", code, response.Error, http.StatusOK)
+	}
+	var stopped entities.JobHTTPData
+	if err := json.Unmarshal(response.Data, &stopped); err != nil {
+		t.Fatal(err)
+	}
+	if stopped.Status != jobStatusCancelled {
+		t.Errorf("DELETE returned status %s, want %s", stopped.Status, jobStatusCancelled)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Errorf("DELETE did not cancel the upstream request")
+	}
+
+	code, response = doJobRequest(t, http.MethodGet, jobsHandlerPath+"/"+job.ID+"/result", "")
+	if code != http.StatusConflict || response.Error == nil || response.Error.Code != errorJobNotFinished {
+		t.Errorf("GET result of cancelled job = %d %+v, want %d with code %d", code, response.Error,
+			http.StatusConflict, errorJobNotFinished)
+	}
+}
+
+func Test_jobHandler_forgets_job_after_ttl(t *testing.T) {
+	defer useJobsTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	})()
+
+	job := startTestJob(t)
+	waitTestJob(t, job.ID)
+
+	properties := validTestProperties(t)
+	properties.Jobs.TTL = 0
+	propsMu.Lock()
+	props = properties
+	propsMu.Unlock()
+	time.Sleep(time.Millisecond)
+
+	code, response := doJobRequest(t, http.MethodGet, jobsHandlerPath+"/"+job.ID, "")
+	if code != http.StatusNotFound || response.Error == nil || response.Error.Code != errorJobNotFound {
+		t.Errorf("GET expired job = %d %+v, want %d with code %d", code, response.Error, http.StatusNotFound,
+			errorJobNotFound)
+	}
+}
+
+func Test_jobsHandler_rejects_wrong_requests(t *testing.T) {
+	defer useJobsTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {})()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantErr  int
+	}{
+		{name: "unknown type", method: http.MethodPost, path: jobsHandlerPath, body: `{"type": "bond"}`,
+			wantCode: http.StatusBadRequest, wantErr: errorJobRequest},
+		{name: "malformed body", method: http.MethodPost, path: jobsHandlerPath, body: `{"type":`,
+			wantCode: http.StatusBadRequest, wantErr: errorJobRequest},
+		{name: "list jobs", method: http.MethodGet, path: jobsHandlerPath, wantCode: http.StatusMethodNotAllowed,
+			wantErr: errorJobRequest},
+		{name: "unknown id", method: http.MethodGet, path: jobsHandlerPath + "/0123456789abcdef",
+			wantCode: http.StatusNotFound, wantErr: errorJobNotFound},
+		{name: "unknown id result", method: http.MethodGet, path: jobsHandlerPath + "/0123456789abcdef/result",
+			wantCode: http.StatusNotFound, wantErr: errorJobNotFound},
+		{name: "unknown subresource", method: http.MethodGet, path: jobsHandlerPath + "/0123456789abcdef/logs",
+			wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := doJobRequest(t, tt.method, tt.path, tt.body)
+			if code != tt.wantCode {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+			if tt.wantErr != 0 && (response.Error == nil || response.Error.Code != tt.wantErr) {
+				t.Errorf("%s %s error = %+v, want code %d", tt.method, tt.path, response.Error, tt.wantErr)
+			}
+		})
+	}
+}
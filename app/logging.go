@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+
+	requestIDHeader = "X-Request-ID"
+)
+
+var (
+	// loggers are component loggers by name, every component has its own level, see log.levels.
+	loggers = make(map[string]*log.Logger)
+
+	serverLog    = newComponentLogger("server")
+	catalogLog   = newComponentLogger("catalog")
+	parserLog    = newComponentLogger("parser")
+	upstreamLog  = newComponentLogger("upstream")
+	schedulerLog = newComponentLogger("scheduler")
+	alertsLog    = newComponentLogger("alerts")
+	configLog    = newComponentLogger("config")
+	historyLog   = newComponentLogger("history")
+
+	// requestIDPattern limits accepted X-Request-ID values, others are replaced with generated ones.
+	requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+)
+
+// newComponentLogger registers a logger of the component, its entries have the component field.
+func newComponentLogger(component string) *log.Entry {
+	logger := log.New()
+	loggers[component] = logger
+	return logger.WithField("component", component)
+}
+
+type logFieldsKey struct{}
+
+// withLogFields returns the context which adds given fields to all entries of logger(ctx, ...).
+func withLogFields(ctx context.Context, fields log.Fields) context.Context {
+	merged := log.Fields{}
+	for key, value := range contextLogFields(ctx) {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+func contextLogFields(ctx context.Context) log.Fields {
+	fields, _ := ctx.Value(logFieldsKey{}).(log.Fields)
+	return fields
+}
+
+// logger returns the entry of the component logger with the fields of the context.
+func logger(ctx context.Context, component *log.Entry) *log.Entry {
+	return component.WithFields(contextLogFields(ctx))
+}
+
+// requestLogger returns the entry of the server logger with the request fields.
+func requestLogger(r *http.Request) *log.Entry {
+	return logger(r.Context(), serverLog).WithFields(log.Fields{
+		"remote": r.RemoteAddr,
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})
+}
+
+// withRequestID takes X-Request-ID of the request or generates a new one, echoes it in the response
+// header and adds it to the log fields of the request context.
+func withRequestID(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		handler(w, r.WithContext(withLogFields(r.Context(), log.Fields{"request_id": id})))
+	}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// parseLogLevels parses "component=level" pairs separated by commas.
+func parseLogLevels(raw string) (map[string]log.Level, error) {
+	levels := make(map[string]log.Level)
+	for _, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("wrong pair %q, expected \"component=level\"", pair)
+		}
+		component := strings.TrimSpace(parts[0])
+		if _, ok := loggers[component]; !ok {
+			return nil, fmt.Errorf("unknown component %q, expected one of %s", component, logComponents())
+		}
+		level, err := log.ParseLevel(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+func logComponents() string {
+	var components []string
+	for component := range loggers {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	return strings.Join(components, ", ")
+}
+
+// configureLogging applies log properties to the standard and component loggers. Wrong values are
+// reported by validateProperties, they are ignored here.
+func configureLogging(properties *Properties) {
+	var formatter log.Formatter = &log.TextFormatter{}
+	if properties.Log.Format == logFormatJSON {
+		formatter = &log.JSONFormatter{}
+	}
+
+	level, err := log.ParseLevel(properties.Log.Level)
+	if err != nil {
+		level = log.InfoLevel
+	}
+	if properties.Debug {
+		level = log.DebugLevel
+	}
+	levels, _ := parseLogLevels(properties.Log.Levels)
+
+	log.SetFormatter(formatter)
+	log.SetLevel(level)
+	for component, logger := range loggers {
+		logger.SetFormatter(formatter)
+		logger.SetOutput(log.StandardLogger().Out)
+		if componentLevel, ok := levels[component]; ok {
+			logger.SetLevel(componentLevel)
+		} else {
+			logger.SetLevel(level)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"ticker-parser/app/entities"
+)
+
+func Test_parseLogLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]log.Level
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: map[string]log.Level{}},
+		{
+			name: "pairs",
+			raw:  "parser=debug, upstream = warn",
+			want: map[string]log.Level{"parser": log.DebugLevel, "upstream": log.WarnLevel},
+		},
+		{name: "unknown component", raw: "unknown=debug", wantErr: true},
+		{name: "wrong level", raw: "parser=loud", wantErr: true},
+		{name: "no level", raw: "parser", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLogLevels(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogLevels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLogLevels() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		generate bool
+	}{
+		{name: "accepted", incoming: "abc-123"},
+		{name: "generated", incoming: "", generate: true},
+		{name: "replaced", incoming: "bad id\n", generate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged string
+			handler := withRequestID(func(w http.ResponseWriter, r *http.Request) {
+				logged, _ = contextLogFields(r.Context())["request_id"].(string)
+				writeHTTPResponse(w, http.StatusOK, entities.NewHTTPResponse(nil, nil, 1, r.URL.Path))
+			})
+			request := httptest.NewRequest(http.MethodGet, "/test", nil)
+			request.Header.Set(requestIDHeader, tt.incoming)
+			recorder := httptest.NewRecorder()
+			handler(recorder, request)
+
+			id := recorder.Header().Get(requestIDHeader)
+			if tt.generate && (id == "" || id == tt.incoming) || !tt.generate && id != tt.incoming {
+				t.Errorf("withRequestID() id = %q for incoming %q", id, tt.incoming)
+			}
+			if logged != id {
+				t.Errorf("withRequestID() log field = %q, want %q", logged, id)
+			}
+			var response entities.HTTPResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.ID != id {
+				t.Errorf("writeHTTPResponse() id = %q (%v), want %q", response.ID, err, id)
+			}
+		})
+	}
+}
+
+func Test_configureLogging(t *testing.T) {
+	defer configureLogging(&Properties{})
+
+	properties := &Properties{}
+	properties.Log.Format = logFormatJSON
+	properties.Log.Level = "warn"
+	properties.Log.Levels = "parser=debug"
+	configureLogging(properties)
+
+	if level := loggers["parser"].GetLevel(); level != log.DebugLevel {
+		t.Errorf("parser level = %s, want debug", level)
+	}
+	if level := loggers["catalog"].GetLevel(); level != log.WarnLevel {
+		t.Errorf("catalog level = %s, want warn", level)
+	}
+
+	var buf bytes.Buffer
+	loggers["parser"].SetOutput(&buf)
+	logger(withLogFields(context.Background(), log.Fields{"request_id": "r1"}), parserLog).WithField("page", 2).Debug("test")
+	line := buf.String()
+	for _, want := range []string{`"component":"parser"`, `"request_id":"r1"`, `"page":2`, `"msg":"test"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %s does not contain %s", line, want)
+		}
+	}
+}
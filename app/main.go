@@ -1,29 +1,112 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorTickerParsing = 1002
+	errorTickerRequest = 1004
 )
 
 var revision = "unknown"
 
 func main() {
+	args, err := initProperties(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			printUsage(os.Stderr)
+			os.Exit(exitOK)
+		}
+		serverLog.WithError(err).Error("cannot load properties")
+		os.Exit(exitUsage)
+	}
+	os.Exit(runCommand(args))
+}
+
+// serve starts the HTTP server and the gRPC one if it is enabled, it returns on server failure or after
+// graceful shutdown.
+func serve() int {
 	fmt.Printf("ticker-parser - %s\n", revision)
 
-	if getProperties().Debug {
-		log.SetLevel(log.DebugLevel)
+	if err := openHistory(); err != nil {
+		serverLog.WithError(err).Error("cannot open history storage")
+		return exitFailure
 	}
 
-	http.HandleFunc("/ticker/", handler)
-	http.HandleFunc(catalogGetHandlerPath, catalogGetHandler)
+	tracingServed = true
+	configureTracing(getProperties())
+
+	go watchConfig()
+
+	if getProperties().Scheduler.Enabled {
+		go runScheduler(appContext)
+	}
+
+	servers := []gracefulServer{&http.Server{
+		Addr:    fmt.Sprintf(":%d", getProperties().Server.Port),
+		Handler: newServeMux(),
+		BaseContext: func(net.Listener) context.Context {
+			return appContext
+		},
+	}}
+	if grpc := getProperties().GRPC; grpc.Enabled {
+		serverLog.Infof("gRPC API is served on port %d", grpc.Port)
+		servers = append(servers, newGRPCServer(grpc.Port))
+	}
+	return runServer(servers...)
+}
+
+// newServeMux registers the API routes on a private mux, so handlers which packages register on
+// http.DefaultServeMux (like /debug/vars of expvar) are never served.
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	handle(mux, "/ticker/", tickerScope, handler)
+	handle(mux, catalogGetHandlerPath, scopeOf(scopeRefresh), catalogGetHandler)
+	handle(mux, changesHandlerPath, scopeOf(scopeRead), changesHandler)
+	handle(mux, statusHandlerPath, scopeOf(scopeRead), statusHandler)
+	handle(mux, configHandlerPath, scopeOf(scopeAdmin), configHandler)
+	handle(mux, configValidateHandlerPath, scopeOf(scopeAdmin), configValidateHandler)
+	handle(mux, jobsHandlerPath, scopeOf(scopeRefresh), jobsHandler)
+	handle(mux, jobsHandlerPath+"/", jobScope, jobHandler)
+	handle(mux, streamHandlerPath, scopeOf(scopeRead), streamHandler)
+	mux.HandleFunc(metricsHandlerPath, metricsHandler)
+	mux.HandleFunc(healthzHandlerPath, withRequestID(healthzHandler))
+	mux.HandleFunc(readyzHandlerPath, withRequestID(readyzHandler))
+	return mux
+}
+
+// handle registers the API handler with request ID, metrics, tracing and authorization for the scope.
+func handle(mux *http.ServeMux, path string, scope requestScope, handler http.HandlerFunc) {
+	mux.HandleFunc(path, withRequestID(instrument(path, authorize(scope, handler))))
+}
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", getProperties().Server.Port), nil))
+// openHistory opens the history storage if it is enabled.
+func openHistory() error {
+	if !getProperties().Storage.Enabled {
+		return nil
+	}
+	store, err := openBoltStore(getProperties().Storage.Path)
+	if err != nil {
+		return err
+	}
+	history = store
+	return nil
 }
 
 func handler(w http.ResponseWriter, r *http.Request) {
+	entry := requestLogger(r)
+
 	filterExtremeEnabled := true
 	if keys, ok := r.URL.Query()["filterExtremeEnabled"]; ok && len(keys) > 0 {
 		// todo uncomment after switching to own library with errors handling
@@ -32,22 +115,65 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		if key, err := strconv.ParseBool(keys[0]); err == nil {
 			filterExtremeEnabled = key
 		} else {
-			log.Errorf("cannot parse filterExtremeEnabled value {%s}: %s", keys[0], err)
+			entry.Errorf("cannot parse filterExtremeEnabled value {%s}: %s", keys[0], err)
 		}
 	}
-	log.Infof("filterExtremeEnabled: %v", filterExtremeEnabled)
+	entry.WithField("filterExtremeEnabled", filterExtremeEnabled).Info("new request")
 
-	tickers, err3 := doTheJob()
+	if short, ok := tickerHistoryPath(r.URL.Path); ok {
+		tickerHistoryHandler(w, r, short)
+		return
+	}
+
+	format, err4 := exportFormat(r)
+	if err4 != nil {
+		entry.Error(err4)
+		httpError := entities.WrapErrors("wrong request", errorTickerRequest, entities.HTTPErrorDetails{
+			Reason:       err4.Error(),
+			Message:      "cannot parse parameter format",
+			Location:     "format",
+			LocationType: "parameter",
+			ExtendedHelp: "use json, csv or xlsx format or Accept header with their media types",
+		})
+		writeHTTPResponse(w, http.StatusBadRequest, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	var tickers *tickerCollection
+	var err3 error
+	exportedAt := clock()
+	if asOf := r.URL.Query().Get("asOf"); asOf != "" {
+		var status int
+		var httpError *entities.HTTPError
+		if tickers, status, httpError = loadTickersAsOf(asOf, "asOf"); httpError != nil {
+			entry.Error(httpError.Errors[0].Reason)
+			writeHTTPResponse(w, status, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+			return
+		}
+		// the export is named by the date its data is actual for, asOf is already validated
+		exportedAt, _ = parseHistoryTime(asOf)
+	} else {
+		tickers, err3 = doTheJob(r.Context())
+	}
 	if err3 != nil {
-		log.Error(err3)
-		w.WriteHeader(500)
-		_, _ = fmt.Fprint(w, err3.Error())
+		entry.Error(err3)
+		httpError := wrapTickerError(err3)
+		status := http.StatusInternalServerError
+		if httpError.Code == errorUpstreamUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeHTTPResponse(w, status, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	if format != formatJSON {
+		writeExport(w, format, tickers, exportedAt)
 		return
 	}
 
 	result, err1 := json.Marshal(tickers)
 	if err1 != nil {
-		log.Error(err1)
+		entry.Error(err1)
 		w.WriteHeader(500)
 		_, _ = fmt.Fprint(w, err1.Error())
 		return
@@ -56,41 +182,165 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	_, err2 := w.Write(result)
 	if err2 != nil {
-		log.Error(err2)
+		entry.Error(err2)
 		w.WriteHeader(500)
 		return
 	}
 }
 
-func doTheJob() (*tickerCollection, error) {
-	tickers, errorz := parseOnline()
+// writeHTTPResponse writes the response with given status, the ID of the response is the request ID
+// unless it is set.
+func writeHTTPResponse(w http.ResponseWriter, status int, response *entities.HTTPResponse) {
+	if response.ID == "" {
+		response.ID = w.Header().Get(requestIDHeader)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		serverLog.Errorf("cannot encode HTTPResponse: %s", err)
+	}
+}
+
+// wrapTickerError converts scrapeTickers error to the HTTPError.
+func wrapTickerError(err error) *entities.HTTPError {
+	parserURL := redactString(redactURL, getProperties().Parser.URL)
+	var openError *circuitOpenError
+	if errors.As(err, &openError) {
+		return entities.WrapErrors("cannot parse tickers", errorUpstreamUnavailable, entities.HTTPErrorDetails{
+			Domain:       upstreamUnavailableDomain,
+			Reason:       err.Error(),
+			Message:      "tickers upstream is unavailable",
+			Location:     parserURL,
+			LocationType: "url",
+			ExtendedHelp: "check upstream state at " + statusHandlerPath,
+		})
+	}
+	if details := rejectedResponseDetails(errors.Unwrap(err)); details != nil {
+		return entities.WrapErrors("cannot parse tickers", errorTickerParsing, *details)
+	}
+	return entities.WrapErrors("cannot parse tickers", errorTickerParsing, entities.HTTPErrorDetails{
+		Reason:       err.Error(),
+		Message:      "cannot parse pages",
+		Location:     parserURL,
+		LocationType: "url",
+		ExtendedHelp: "check your configuration parameter: parser.url\n" +
+			"current value: " + parserURL,
+	})
+}
+
+type jobResult struct {
+	tickers *tickerCollection
+	event   *scrapeEvent
+	err     error
+}
+
+// doTheJob parses and filters tickers, concurrent calls share one execution.
+func doTheJob(ctx context.Context) (*tickerCollection, error) {
+	result := runTheJob(ctx)
+	return result.tickers, result.err
+}
+
+// runTheJob is doTheJob which also returns the scrape event, concurrent calls share one execution.
+// It returns as soon as ctx is cancelled, the execution stops if no other caller waits for it.
+func runTheJob(ctx context.Context) jobResult {
+	result, err := flights.do(ctx, "doTheJob", "doTheJob", func(ctx context.Context) interface{} {
+		tickers, event, err := scrapeTickers(ctx, nil)
+		return jobResult{tickers: tickers, event: event, err: err}
+	})
+	if err != nil {
+		return jobResult{err: fmt.Errorf("scraping cancelled: %w", err)}
+	}
+	return result.(jobResult)
+}
+
+// scrapeTickers parses and filters tickers, reports progress to given progress if it is not nil.
+func scrapeTickers(ctx context.Context, progress *scrapeProgress) (collection *tickerCollection, event *scrapeEvent, err error) {
+	start := time.Now()
+	defer func() {
+		observeScrape("ticker", start, err)
+	}()
+
+	tickers, errorz := parseOnline(ctx, progress)
 	if len(errorz) != 0 {
-		log.Error(errorz)
-		return nil, fmt.Errorf("cannot parse pages, check the logs:\n%s", errorz)
+		logger(ctx, parserLog).Error(errorz)
+		for _, err := range errorz {
+			switch err.(type) {
+			case *circuitOpenError, *bodyTooLargeError, *contentTypeError:
+				return nil, nil, fmt.Errorf("cannot parse pages: %w", err)
+			}
+		}
+		return nil, nil, fmt.Errorf("cannot parse pages, check the logs:\n%s", errorz)
 	}
 
-	filteredTickers := filter(tickers)
+	collection, event = finishScrape(ctx, tickers)
+	return collection, event, nil
+}
+
+// finishScrape filters successfully parsed tickers, records the scrape, publishes ticker updates and
+// checks alert rules. Every recorded scrape is checked whatever triggered it, otherwise crossings
+// between the previous scrape and this one would be missed by the next check.
+func finishScrape(ctx context.Context, tickers *[]stockTicker) (*tickerCollection, *scrapeEvent) {
+	scrapeTime := clock()
+	filteredTickers := filter(ctx, tickers, scrapeTime)
+	event := recordScrape(scrapeTime, tickers, filteredTickers)
+	tickerUpdates.publish(detectUpdates(event), int(getProperties().Stream.Replay))
+	checkAlerts(event)
 
-	return &tickerCollection{Tickers: filteredTickers}, nil
+	return &tickerCollection{Tickers: filteredTickers}, event
 }
 
-func filter(tickers *[]stockTicker) *[]stockTicker {
-	var filters []func(*stockTicker) error
-	filters = append(filters, filterOldForecasts)
-	filters = append(filters, filterExtremeForecasts)
+// filter drops tickers which do not pass the filters and calculates consensus for the others.
+// The clock of the filters is pinned to given time. Every filter is applied to the tickers passed
+// the previous ones.
+func filter(ctx context.Context, tickers *[]stockTicker, at time.Time) *[]stockTicker {
+	return applyFilters(ctx, tickers, at, true)
+}
 
-	var filteredTickers []stockTicker
-	for _, ticker := range *tickers {
-		ok := true
-		for _, filter := range filters {
-			if err := filter(&ticker); err != nil {
-				ok = false
-				break
+// filterStored filters tickers rebuilt from the history like filter does, but it neither traces nor
+// counts the dropped values, since the metrics describe scrapes.
+func filterStored(tickers *[]stockTicker, at time.Time) *[]stockTicker {
+	return applyFilters(context.Background(), tickers, at, false)
+}
+
+func applyFilters(ctx context.Context, tickers *[]stockTicker, at time.Time, scraped bool) *[]stockTicker {
+	filters := []struct {
+		name   string
+		filter tickerFilter
+	}{
+		{name: "old", filter: filterOldForecasts},
+		{name: "extreme", filter: filterExtremeForecasts},
+	}
+
+	filteredTickers := append([]stockTicker(nil), *tickers...)
+	for _, filter := range filters {
+		var filterSpan *span
+		if scraped {
+			_, filterSpan = startSpan(ctx, "filter "+filter.name, spanKindInternal)
+		}
+		filterSpan.setAttribute("filter", filter.name)
+		filterSpan.setAttribute("tickers.in", len(filteredTickers))
+
+		var passed []stockTicker
+		dropped := 0
+		for _, ticker := range filteredTickers {
+			before := len(*ticker.Forecasts)
+			err := filter.filter(&ticker, at)
+			dropped += before - len(*ticker.Forecasts)
+			if err != nil {
+				if scraped {
+					tickersDropped.add(1, filter.name)
+				}
+				continue
 			}
+			passed = append(passed, ticker)
 		}
-		if ok {
-			filteredTickers = append(filteredTickers, ticker)
+		if scraped {
+			forecastsDropped.add(float64(dropped), filter.name)
 		}
+		filterSpan.setAttribute("tickers.dropped", len(filteredTickers)-len(passed))
+		filterSpan.setAttribute("forecasts.dropped", dropped)
+		filterSpan.finish()
+		filteredTickers = passed
 	}
 
 	for i, ticker := range filteredTickers {
@@ -99,7 +349,9 @@ func filter(tickers *[]stockTicker) *[]stockTicker {
 			sum += forecast.ExpectedDiff
 		}
 		filteredTickers[i].Consensus = sum / float64(len(*ticker.Forecasts))
-		log.Infof("%v", ticker)
+		if scraped {
+			parserLog.WithField("ticker", ticker.Name.Short).Infof("%v", ticker)
+		}
 	}
 
 	return &filteredTickers
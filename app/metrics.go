@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+var (
+	metricsHandlerPath = "/metrics"
+
+	metrics = newMetricsRegistry()
+
+	durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+	scrapeDuration = metrics.histogram("ticker_parser_scrape_duration_seconds",
+		"Duration of scrapes by source.", durationBuckets, "source")
+	scrapesTotal = metrics.counter("ticker_parser_scrapes_total",
+		"Scrapes by source and outcome.", "source", "outcome")
+	upstreamResponses = metrics.counter("ticker_parser_upstream_responses_total",
+		"Upstream responses by status code, error for network errors and circuit_open for rejected requests.", "code")
+	parseErrors = metrics.counter("ticker_parser_parse_errors_total",
+		"Page parsing errors by type: document, price, target, date and count.", "type")
+	forecastsDropped = metrics.counter("ticker_parser_forecasts_dropped_total",
+		"Forecasts removed by filters.", "filter")
+	tickersDropped = metrics.counter("ticker_parser_tickers_dropped_total",
+		"Tickers dropped by filters.", "filter")
+	catalogItems = metrics.gauge("ticker_parser_catalog_items",
+		"Items of the last fetched catalog by type.", "type")
+	httpRequestDuration = metrics.histogram("ticker_parser_http_request_duration_seconds",
+		"Duration of HTTP requests by handler, method and status code.", durationBuckets, "handler", "method", "code")
+	dataAge = metrics.gauge("ticker_parser_data_age_seconds",
+		"Seconds since the last successful ticker scrape.")
+	configReloadsTotal = metrics.counter("ticker_parser_config_reloads_total",
+		"Configuration reloads by result.", "result")
+	upstreamCircuitOpen = metrics.gauge("ticker_parser_upstream_circuit_open",
+		"1 if the circuit breaker of the upstream host is not closed.", "host")
+)
+
+func init() {
+	metrics.onCollect(func() {
+		if at, ok := lastScrapeTime(); ok {
+			dataAge.set(time.Since(at).Seconds())
+		}
+		for _, status := range breakers.states(0) {
+			open := 0.0
+			if status.State != circuitClosed {
+				open = 1
+			}
+			upstreamCircuitOpen.set(open, status.Host)
+		}
+	})
+}
+
+// metricsRegistry keeps metrics in registration order and writes them in Prometheus text format.
+type metricsRegistry struct {
+	mu         sync.Mutex
+	vectors    []*metricVector
+	collectors []func()
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{}
+}
+
+// onCollect registers the function which updates gauges right before every exposition.
+func (ptr *metricsRegistry) onCollect(collect func()) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.collectors = append(ptr.collectors, collect)
+}
+
+func (ptr *metricsRegistry) register(vector *metricVector) *metricVector {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.vectors = append(ptr.vectors, vector)
+	return vector
+}
+
+func (ptr *metricsRegistry) counter(name string, help string, labels ...string) *metricVector {
+	return ptr.register(newMetricVector(name, help, metricCounter, nil, labels))
+}
+
+func (ptr *metricsRegistry) gauge(name string, help string, labels ...string) *metricVector {
+	return ptr.register(newMetricVector(name, help, metricGauge, nil, labels))
+}
+
+func (ptr *metricsRegistry) histogram(name string, help string, buckets []float64, labels ...string) *metricVector {
+	return ptr.register(newMetricVector(name, help, metricHistogram, buckets, labels))
+}
+
+// write runs the collectors and writes all metrics in Prometheus text exposition format 0.0.4.
+func (ptr *metricsRegistry) write(w io.Writer) error {
+	ptr.mu.Lock()
+	collectors := append([]func(){}, ptr.collectors...)
+	vectors := append([]*metricVector{}, ptr.vectors...)
+	ptr.mu.Unlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+	for _, vector := range vectors {
+		if err := vector.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricVector is a metric with all its label values combinations.
+type metricVector struct {
+	name    string
+	help    string
+	kind    string
+	buckets []float64
+	labels  []string
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64  // counter and gauge value
+	counts      []uint64 // histogram bucket counts, not cumulative
+	sum         float64
+	count       uint64
+}
+
+func newMetricVector(name string, help string, kind string, buckets []float64, labels []string) *metricVector {
+	return &metricVector{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		buckets: buckets,
+		labels:  labels,
+		series:  make(map[string]*metricSeries),
+	}
+}
+
+// get returns the series of the label values, it must be called with the lock held.
+func (ptr *metricVector) get(labelValues []string) *metricSeries {
+	if len(labelValues) != len(ptr.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", ptr.name, len(ptr.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	series, ok := ptr.series[key]
+	if !ok {
+		series = &metricSeries{labelValues: append([]string{}, labelValues...)}
+		if ptr.kind == metricHistogram {
+			series.counts = make([]uint64, len(ptr.buckets))
+		}
+		ptr.series[key] = series
+	}
+	return series
+}
+
+// add increments counter or gauge by delta.
+func (ptr *metricVector) add(delta float64, labelValues ...string) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.get(labelValues).value += delta
+}
+
+// set sets gauge value.
+func (ptr *metricVector) set(value float64, labelValues ...string) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.get(labelValues).value = value
+}
+
+// reset removes all series, gauges set from scratch use it.
+func (ptr *metricVector) reset() {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.series = make(map[string]*metricSeries)
+}
+
+// observe adds the value to histogram.
+func (ptr *metricVector) observe(value float64, labelValues ...string) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	series := ptr.get(labelValues)
+	for i, bound := range ptr.buckets {
+		if value <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func (ptr *metricVector) write(w io.Writer) error {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s %s\n", ptr.name, escapeMetricHelp(ptr.help), ptr.name, ptr.kind)
+
+	keys := make([]string, 0, len(ptr.series))
+	for key := range ptr.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := ptr.series[key]
+		if ptr.kind != metricHistogram {
+			fmt.Fprintf(&builder, "%s%s %s\n", ptr.name, ptr.labelsText(series.labelValues, "", ""), formatMetricValue(series.value))
+			continue
+		}
+
+		cumulative := uint64(0)
+		for i, bound := range ptr.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(&builder, "%s_bucket%s %d\n", ptr.name,
+				ptr.labelsText(series.labelValues, "le", formatMetricValue(bound)), cumulative)
+		}
+		fmt.Fprintf(&builder, "%s_bucket%s %d\n", ptr.name, ptr.labelsText(series.labelValues, "le", "+Inf"), series.count)
+		fmt.Fprintf(&builder, "%s_sum%s %s\n", ptr.name, ptr.labelsText(series.labelValues, "", ""), formatMetricValue(series.sum))
+		fmt.Fprintf(&builder, "%s_count%s %d\n", ptr.name, ptr.labelsText(series.labelValues, "", ""), series.count)
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// labelsText returns {name="value",...} with the extra label appended if it is set.
+func (ptr *metricVector) labelsText(values []string, extraName string, extraValue string) string {
+	var pairs []string
+	for i, name := range ptr.labels {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func escapeMetricHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// observeScrape records duration and outcome of a scrape started at given time.
+func observeScrape(source string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	scrapeDuration.observe(time.Since(start).Seconds(), source)
+	scrapesTotal.add(1, source, outcome)
+}
+
+// statusRecorder remembers the status code written by a handler, flushing is passed through for streams.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (ptr *statusRecorder) WriteHeader(status int) {
+	if ptr.status == 0 {
+		ptr.status = status
+	}
+	ptr.ResponseWriter.WriteHeader(status)
+}
+
+func (ptr *statusRecorder) Write(data []byte) (int, error) {
+	if ptr.status == 0 {
+		ptr.status = http.StatusOK
+	}
+	return ptr.ResponseWriter.Write(data)
+}
+
+func (ptr *statusRecorder) Flush() {
+	if flusher, ok := ptr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrument records latency and status code of the handler requests under the name and traces them,
+// the trace is continued if the request has traceparent header.
+func instrument(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, span := startSpan(withRemoteParent(r.Context(), r.Header), r.Method+" "+name, spanKindServer)
+		span.setAttribute("http.method", r.Method)
+		span.setAttribute("http.route", name)
+		span.setAttribute("http.target", r.URL.RequestURI())
+		if id, ok := contextLogFields(ctx)["request_id"].(string); ok {
+			span.setAttribute("request_id", id)
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler(recorder, r.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		httpRequestDuration.observe(time.Since(start).Seconds(), name, r.Method, strconv.Itoa(recorder.status))
+
+		span.setAttribute("http.status_code", recorder.status)
+		if recorder.status >= http.StatusInternalServerError {
+			span.recordError(fmt.Errorf("status code %d", recorder.status))
+		}
+		span.finish()
+	}
+}
+
+// metricsHandler serves GET /metrics in Prometheus text format.
+func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.write(w); err != nil {
+		serverLog.Errorf("cannot write metrics: %s", err)
+	}
+}
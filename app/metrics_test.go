@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_metricVector_write(t *testing.T) {
+	tests := []struct {
+		name   string
+		vector *metricVector
+		update func(vector *metricVector)
+		want   string
+	}{
+		{
+			name:   "counter with labels",
+			vector: newMetricVector("test_total", "Test counter.", metricCounter, nil, []string{"code"}),
+			update: func(vector *metricVector) {
+				vector.add(1, "200")
+				vector.add(2, "500")
+				vector.add(1, "200")
+			},
+			want: "# HELP test_total Test counter.\n# TYPE test_total counter\n" +
+				"test_total{code=\"200\"} 2\ntest_total{code=\"500\"} 2\n",
+		},
+		{
+			name:   "gauge without labels",
+			vector: newMetricVector("test_age", "Test gauge.", metricGauge, nil, nil),
+			update: func(vector *metricVector) {
+				vector.set(1.5)
+			},
+			want: "# HELP test_age Test gauge.\n# TYPE test_age gauge\ntest_age 1.5\n",
+		},
+		{
+			name:   "escaped label value",
+			vector: newMetricVector("test_info", "Test\nhelp.", metricGauge, nil, []string{"host"}),
+			update: func(vector *metricVector) {
+				vector.set(1, "a\"b\\c")
+			},
+			want: "# HELP test_info Test\\nhelp.\n# TYPE test_info gauge\ntest_info{host=\"a\\\"b\\\\c\"} 1\n",
+		},
+		{
+			name:   "histogram buckets are cumulative",
+			vector: newMetricVector("test_seconds", "Test histogram.", metricHistogram, []float64{0.1, 1}, []string{"source"}),
+			update: func(vector *metricVector) {
+				vector.observe(0.05, "ticker")
+				vector.observe(0.5, "ticker")
+				vector.observe(5, "ticker")
+			},
+			want: "# HELP test_seconds Test histogram.\n# TYPE test_seconds histogram\n" +
+				"test_seconds_bucket{source=\"ticker\",le=\"0.1\"} 1\n" +
+				"test_seconds_bucket{source=\"ticker\",le=\"1\"} 2\n" +
+				"test_seconds_bucket{source=\"ticker\",le=\"+Inf\"} 3\n" +
+				"test_seconds_sum{source=\"ticker\"} 5.55\n" +
+				"test_seconds_count{source=\"ticker\"} 3\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.update(tt.vector)
+			var builder strings.Builder
+			if err := tt.vector.write(&builder); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			if got := builder.String(); got != tt.want {
+				t.Errorf("write() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_instrument(t *testing.T) {
+	handler := instrument("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	recorder := httptest.NewRecorder()
+	metricsHandler(recorder, httptest.NewRequest(http.MethodGet, metricsHandlerPath, nil))
+
+	body := recorder.Body.String()
+	want := `ticker_parser_http_request_duration_seconds_count{handler="/test",method="GET",code="418"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("metrics do not contain %s:\n%s", want, body)
+	}
+	if !strings.Contains(body, "# TYPE ticker_parser_scrapes_total counter") {
+		t.Errorf("metrics do not contain scrapes counter:\n%s", body)
+	}
+}
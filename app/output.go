@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"ticker-parser/app/entities"
+)
+
+const (
+	formatJSON  = "json"
+	formatCSV   = "csv"
+	formatTable = "table"
+)
+
+// writeTickers writes tickers in the format: json is the same as /ticker/ response, csv and table have
+// one row per ticker.
+func writeTickers(w io.Writer, format string, tickers *tickerCollection) error {
+	if format == formatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tickers)
+	}
+
+	header := []string{"ticker", "name", "price", "consensus", "forecasts"}
+	var rows [][]string
+	for _, ticker := range *tickers.Tickers {
+		count := 0
+		if ticker.Forecasts != nil {
+			count = len(*ticker.Forecasts)
+		}
+		rows = append(rows, []string{
+			ticker.Name.Short,
+			ticker.Name.Full,
+			strconv.FormatFloat(ticker.CurrentPrice, 'f', -1, 64),
+			strconv.FormatFloat(ticker.Consensus, 'f', 2, 64),
+			strconv.Itoa(count),
+		})
+	}
+	return writeRows(w, format, header, rows)
+}
+
+// writeCatalog writes catalog items in the format: json is the same as /catalog/fetch data, csv and table
+// have one row per item.
+func writeCatalog(w io.Writer, format string, data *entities.CatalogHTTPData) error {
+	if format == formatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	}
+
+	header := []string{"title", "company", "type", "price", "currency", "url"}
+	var rows [][]string
+	for _, item := range data.Items {
+		rows = append(rows, []string{
+			item.Title,
+			item.Company.Name,
+			item.Type,
+			strconv.FormatFloat(item.Price, 'f', -1, 64),
+			item.Currency,
+			item.URL,
+		})
+	}
+	return writeRows(w, format, header, rows)
+}
+
+func writeRows(w io.Writer, format string, header []string, rows [][]string) error {
+	switch format {
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	case formatTable:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, row := range append([][]string{header}, rows...) {
+			for i, cell := range row {
+				if i != 0 {
+					_, _ = fmt.Fprint(writer, "\t")
+				}
+				_, _ = fmt.Fprint(writer, cell)
+			}
+			_, _ = fmt.Fprintln(writer)
+		}
+		return writer.Flush()
+	}
+	return fmt.Errorf("unknown format %s", format)
+}
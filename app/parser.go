@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/html/charset"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const expectedForecastsCount = 5
@@ -26,15 +31,25 @@ func getPriceValue(rawText string) (float64, error) {
 }
 
 // Parse extracts satellite items from given reader and sends them to given chData channel.
-// Occurred errors are sent to chErr channel. url string is used for tracing purposes only.
-func Parse(url string, reader io.Reader, chData chan stockTicker, chErr chan error) {
-	log.Debugf("parsing started: %s", url)
+// Occurred errors are sent to chErr channel. url string and ctx are used for logging purposes only.
+func Parse(ctx context.Context, url string, reader io.Reader, chData chan stockTicker, chErr chan error) {
+	_, span := startSpan(ctx, "Parse", spanKindInternal)
+	defer span.finish()
+	span.setAttribute("http.url", url)
+	fail := func(err error) {
+		span.recordError(err)
+		chErr <- err
+	}
+
+	entry := logger(ctx, parserLog).WithField("url", url)
+	entry.Debugf("parsing started: %s", url)
 
 	document, err1 := goquery.NewDocumentFromReader(reader)
 	if err1 != nil {
 		err1 = fmt.Errorf("error reading HTTP response body (%s): %w", url, err1)
-		log.Debug(err1)
-		chErr <- err1
+		entry.Debug(err1)
+		parseErrors.add(1, "document")
+		fail(err1)
 		return
 	}
 
@@ -45,13 +60,16 @@ func Parse(url string, reader io.Reader, chData chan stockTicker, chErr chan err
 
 	shortNameRaw := document.Find(".header__tool__name-short").Text()
 	ticker.Name.Short = strings.TrimSpace(shortNameRaw)
+	entry = entry.WithField("ticker", ticker.Name.Short)
+	span.setAttribute("ticker", ticker.Name.Short)
 
 	currentRaw := document.Find(".chart__info__sum").Text()
 	currentPrice, err2 := getPriceValue(currentRaw)
 	if err2 != nil {
 		err2 = fmt.Errorf("error parsing the price (%s) for %s: %w", currentRaw, ticker.Name.Full, err2)
-		log.Debug(err2)
-		chErr <- err2
+		entry.Debug(err2)
+		parseErrors.add(1, "price")
+		fail(err2)
 		return
 	}
 	ticker.CurrentPrice = currentPrice
@@ -63,26 +81,28 @@ func Parse(url string, reader io.Reader, chData chan stockTicker, chErr chan err
 			priceValue, err := getPriceValue(forecastRaw)
 			if err != nil {
 				err = fmt.Errorf("error parsing a forecast target price (%s) for %s: %w", forecastRaw, ticker.Name.Full, err)
-				log.Debug(err)
-				chErr <- err
+				entry.Debug(err)
+				parseErrors.add(1, "target")
+				fail(err)
 				return
 			}
 
 			percent := (priceValue - currentPrice) / currentPrice * 100
-			forecast := forecast{ExpectedDiff: percent}
+			forecast := forecast{Target: priceValue, ExpectedDiff: percent}
 			forecasts = append(forecasts, forecast)
 		}).Length()
 
 	if forecastsCount > expectedForecastsCount {
-		log.Warnf("expected %d forecasts, but got %d for %s", expectedForecastsCount, forecastsCount, ticker.Name.Full)
+		entry.Warnf("expected %d forecasts, but got %d for %s", expectedForecastsCount, forecastsCount, ticker.Name.Full)
 	}
 
 	datesCount := document.Find(".js-review .item__review__date_big").
 		Each(func(i int, selection *goquery.Selection) {
 			if i > forecastsCount {
 				err := fmt.Errorf("too many time values for %d forecasts for %s", forecastsCount, ticker.Name.Full)
-				log.Debug(err)
-				chErr <- err
+				entry.Debug(err)
+				parseErrors.add(1, "count")
+				fail(err)
 				return
 			}
 
@@ -90,8 +110,9 @@ func Parse(url string, reader io.Reader, chData chan stockTicker, chErr chan err
 			time, err := parseTime(timeRaw)
 			if err != nil {
 				err = fmt.Errorf("error parsing the time (%s) for %s: %w", timeRaw, ticker.Name.Full, err)
-				log.Debug(err)
-				chErr <- err
+				entry.Debug(err)
+				parseErrors.add(1, "date")
+				fail(err)
 				return
 			}
 
@@ -101,30 +122,48 @@ func Parse(url string, reader io.Reader, chData chan stockTicker, chErr chan err
 
 	if forecastsCount != datesCount {
 		err := fmt.Errorf("dates count %d is differ from forecasts count %d for %s", datesCount, forecastsCount, ticker.Name.Full)
-		log.Debug(err)
-		chErr <- err
+		entry.Debug(err)
+		parseErrors.add(1, "count")
+		fail(err)
 		return
 	}
 
-	log.Debugf("got forecasts for %s: %v", ticker.Name.Full, ticker.Forecasts)
+	// analyst names are optional, forecasts without them are identified by ticker and date only
+	analysts := document.Find(".js-review .item__review__author")
+	if analysts.Length() != 0 && analysts.Length() != forecastsCount {
+		entry.Warnf("analysts count %d is differ from forecasts count %d for %s", analysts.Length(), forecastsCount, ticker.Name.Full)
+	} else {
+		analysts.Each(func(i int, selection *goquery.Selection) {
+			forecasts[i].Analyst = strings.TrimSpace(selection.Text())
+		})
+	}
+	for i := range forecasts {
+		forecasts[i].ID = forecastID(ticker.Name.Short, forecasts[i].Analyst, forecasts[i].Time)
+	}
+
+	entry.Debugf("got forecasts for %s: %v", ticker.Name.Full, ticker.Forecasts)
 
+	span.setAttribute("forecasts.count", forecastsCount)
 	chData <- ticker
-	log.Debugf("parsing finished. %d forecasts processed for %s", forecastsCount, ticker.Name.Full)
+	entry.Debugf("parsing finished. %d forecasts processed for %s", forecastsCount, ticker.Name.Full)
 }
 
-func getResponse(url string) (*http.Response, error) {
-	log.Debugf("loading content of %s ...", url)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+// getResponse loads the url with the shared upstream client, the response status code is always 200.
+// The request is cancelled with ctx, the limits are applied to cached responses.
+func getResponse(ctx context.Context, url string, limits responseLimits) (*http.Response, error) {
+	entry := logger(ctx, parserLog).WithField("url", url)
+	entry.Debugf("loading content of %s ...", url)
+	client, err1 := getUpstreamClient()
+	if err1 != nil {
+		return nil, fmt.Errorf("cannot create http client, check parser.http configuration: %w", err1)
 	}
-	log.Debugf("got response from %s", url)
 
-	if resp.StatusCode != 200 {
-		err = fmt.Errorf("cannot get document (%s): status code is %d", url, resp.StatusCode)
-		log.Debug(err)
-		return nil, err
+	resp, err2 := client.get(ctx, url, limits)
+	if err2 != nil {
+		entry.Debug(err2)
+		return nil, err2
 	}
+	entry.Debugf("got response from %s", url)
 
 	return resp, nil
 }
@@ -133,23 +172,16 @@ func closeReader(response *http.Response) error {
 	return response.Body.Close()
 }
 
-func getUtf8Reader(response *http.Response) (io.Reader, error) {
-	contentType := response.Header.Get("Content-Type")
-	reader, err := charset.NewReader(response.Body, contentType)
-	if err != nil {
-		return nil, fmt.Errorf("cannot convert document to utf-8: %w", err)
-	}
-
-	return reader, nil
-}
-
 // parseOnline runs pages parsing in goroutines, compiles, sorts and returns satellites array.
-func parseOnline() (*[]stockTicker, []error) {
+// Progress is reported to given progress if it is not nil. Cancelled ctx makes the goroutines finish
+// promptly with errors, the channels are closed after all of them finished, so none is left blocked.
+func parseOnline(ctx context.Context, progress *scrapeProgress) (*[]stockTicker, []error) {
 	ch, chErr, chQuit := make(chan stockTicker), make(chan error), make(chan int)
 	ongoing := 0
 
 	//for _, url := range getProperties().Parser.Urls {
-	go parseOnlinePage(getProperties().Parser.URL, ch, chErr, chQuit)
+	progress.pageScheduled()
+	go parseOnlinePage(ctx, getProperties().Parser.URL, ch, chErr, chQuit)
 	//}
 
 	var tickers []stockTicker
@@ -162,8 +194,13 @@ WaiterLoop:
 			tickers = append(tickers, receivedSat)
 		case receivedErr := <-chErr:
 			errorz = append(errorz, receivedErr)
+			progress.addError(receivedErr)
 		case count := <-chQuit:
 			ongoing += count
+			progress.addOngoing(count)
+			if count < 0 {
+				progress.pageDone()
+			}
 			if ongoing == 0 {
 				break WaiterLoop
 			}
@@ -176,28 +213,156 @@ WaiterLoop:
 	return &tickers, errorz
 }
 
-func parseOnlinePage(url string, chData chan stockTicker, chErr chan error, chCounter chan int) {
+func parseOnlinePage(ctx context.Context, url string, chData chan stockTicker, chErr chan error, chCounter chan int) {
+	ctx = withLogFields(ctx, log.Fields{"url": url})
+	ctx, span := startSpan(ctx, "parseOnlinePage", spanKindInternal)
+	span.setAttribute("http.url", url)
 	chCounter <- 1
 	defer func() {
+		span.finish()
 		chCounter <- -1
 	}()
 
-	httpResponse, err1 := getResponse(url)
-	if err1 != nil {
-		chErr <- err1
+	if err := ctx.Err(); err != nil {
+		chErr <- fmt.Errorf("parsing of %s cancelled: %w", url, err)
 		return
 	}
+
+	shared, err := flights.do(ctx, "parseOnlinePage", url, func(ctx context.Context) interface{} {
+		return scrapePage(ctx, url)
+	})
+	if err != nil {
+		err = fmt.Errorf("parsing of %s cancelled: %w", url, err)
+		span.recordError(err)
+		chErr <- err
+		return
+	}
+	result := shared.(pageResult)
+	span.setAttribute("tickers.count", len(result.tickers))
+	span.setAttribute("errors.count", len(result.errors))
+	if len(result.errors) != 0 {
+		span.recordError(result.errors[0])
+	}
+
+	for _, err := range result.errors {
+		chErr <- err
+	}
+	for _, ticker := range result.tickers {
+		// coalesced callers must not share forecasts which are modified by filters
+		forecasts := append([]forecast(nil), *ticker.Forecasts...)
+		ticker.Forecasts = &forecasts
+		chData <- ticker
+	}
+}
+
+type pageResult struct {
+	tickers []stockTicker
+	errors  []error
+}
+
+// parsedPages keeps the last successful result of every page by the content hash, so unchanged
+// pages are not parsed again.
+var parsedPages = &parsedPageCache{pages: make(map[string]parsedPage)}
+
+type parsedPage struct {
+	hash   string
+	result pageResult
+}
+
+type parsedPageCache struct {
+	mu    sync.Mutex
+	pages map[string]parsedPage
+}
+
+func (ptr *parsedPageCache) get(url string, hash string) (pageResult, bool) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	page, ok := ptr.pages[url]
+	if !ok || page.hash != hash {
+		return pageResult{}, false
+	}
+	return page.result, true
+}
+
+func (ptr *parsedPageCache) put(url string, hash string, result pageResult) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.pages[url] = parsedPage{hash: hash, result: result}
+}
+
+// scrapePage loads the page and parses it unless the content is the same as the last time.
+func scrapePage(ctx context.Context, url string) pageResult {
+	body, contentType, err := loadPage(ctx, url)
+	if err != nil {
+		return pageResult{errors: []error{err}}
+	}
+
+	hash := fmt.Sprintf("%x", sha256.Sum256(body))
+	if result, ok := parsedPages.get(url, hash); ok {
+		logger(ctx, parserLog).Debugf("content of %s is unchanged, parsing skipped", url)
+		return result
+	}
+
+	result := parsePage(ctx, url, body, contentType)
+	if len(result.errors) == 0 {
+		parsedPages.put(url, hash, result)
+	}
+	return result
+}
+
+// parsePage runs Parse over the body and collects everything it sends to the channels.
+func parsePage(ctx context.Context, url string, body []byte, contentType string) pageResult {
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return pageResult{errors: []error{fmt.Errorf("cannot convert document to utf-8: %w", err)}}
+	}
+
+	chData, chErr, chDone := make(chan stockTicker), make(chan error), make(chan struct{})
+	go func() {
+		defer close(chDone)
+		Parse(ctx, url, reader, chData, chErr)
+	}()
+
+	var result pageResult
+	for {
+		select {
+		case ticker := <-chData:
+			result.tickers = append(result.tickers, ticker)
+		case err := <-chErr:
+			result.errors = append(result.errors, err)
+		case <-chDone:
+			return result
+		}
+	}
+}
+
+// loadPage reads the whole page body and returns it with the content type.
+func loadPage(ctx context.Context, url string) ([]byte, string, error) {
+	limits := responseLimits{
+		limit:        getProperties().Parser.HTTP.Limits.Page,
+		parameter:    "parser.http.limits.page",
+		contentTypes: htmlContentTypes,
+	}
+	httpResponse, err1 := getResponse(ctx, url, limits)
+	if err1 != nil {
+		return nil, "", err1
+	}
 	defer func() {
 		if err := closeReader(httpResponse); err != nil {
-			chErr <- err
+			logger(ctx, parserLog).Error(fmt.Errorf("cannot close response from (%s) body: %w", url, err))
 		}
 	}()
 
-	reader, err2 := getUtf8Reader(httpResponse)
-	if err2 != nil {
-		chErr <- err2
-		return
+	if err2 := checkContentType(url, httpResponse, limits.contentTypes); err2 != nil {
+		return nil, "", err2
 	}
 
-	Parse(url, reader, chData, chErr)
+	body, err3 := ioutil.ReadAll(limitBody(url, httpResponse, limits.limit, limits.parameter))
+	if _, ok := err3.(*bodyTooLargeError); ok {
+		return nil, "", err3
+	}
+	if err3 != nil {
+		return nil, "", fmt.Errorf("error reading HTTP response body (%s): %w", url, err3)
+	}
+	return body, httpResponse.Header.Get("Content-Type"), nil
 }
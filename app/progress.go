@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"ticker-parser/app/entities"
+)
+
+// scrapeProgress collects progress of a running scrape. All methods are safe to call on nil pointer,
+// so scrapes which nobody watches just pass nil.
+type scrapeProgress struct {
+	mu         sync.Mutex
+	pagesDone  int
+	pagesTotal int
+	ongoing    int
+	errors     []string
+}
+
+func (ptr *scrapeProgress) pageScheduled() {
+	if ptr == nil {
+		return
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.pagesTotal++
+}
+
+func (ptr *scrapeProgress) pageDone() {
+	if ptr == nil {
+		return
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.pagesDone++
+}
+
+// addOngoing works the same way as chCounter does, count is 1 for started and -1 for finished routine.
+func (ptr *scrapeProgress) addOngoing(count int) {
+	if ptr == nil {
+		return
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.ongoing += count
+}
+
+func (ptr *scrapeProgress) addError(err error) {
+	if ptr == nil {
+		return
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.errors = append(ptr.errors, err.Error())
+}
+
+func (ptr *scrapeProgress) snapshot() entities.JobProgress {
+	if ptr == nil {
+		return entities.JobProgress{}
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	return entities.JobProgress{
+		PagesDone:  ptr.pagesDone,
+		PagesTotal: ptr.pagesTotal,
+		Ongoing:    ptr.ongoing,
+		Errors:     append([]string{}, ptr.errors...),
+	}
+}
@@ -1,18 +1,71 @@
 package main
 
 import (
-	"github.com/artemkaxboy/go-hocon"
 	"github.com/sirupsen/logrus"
+	"os"
+	"sync"
 )
 
 // Properties struct is used for loading and providing access to configuration file.
 type Properties struct {
 	Debug bool `hocon:"node=debug,default=false"`
 
+	// Log format is text or json. Level is applied to all components except those listed in levels as
+	// "component=level" pairs separated by commas, e.g. "parser=debug,upstream=warn". Components are
+	// server, catalog, parser, upstream, scheduler, alerts, config and history. Debug forces debug level
+	// for components without own level.
+	Log struct {
+		Format string `hocon:"node=format,default=text"`
+		Level  string `hocon:"node=level,default=info"`
+		Levels string `hocon:"node=levels,default="`
+	} `hocon:"node=log"`
+
+	// Auth requires an API key in Header for all API requests except /metrics, /healthz and /readyz.
+	// Keys are separated by ';' or new lines, see parseAPIKeys for the syntax. Rate is requests per minute
+	// and Burst is the number of requests at once for keys without own limits, zero rate means no limit.
+	Auth struct {
+		Enabled bool    `hocon:"node=enabled,default=false"`
+		Header  string  `hocon:"node=header,default=X-API-Key"`
+		Keys    string  `hocon:"node=keys,default=" redact:"secret"`
+		Rate    float64 `hocon:"node=rate,default=60"`
+		Burst   int64   `hocon:"node=burst,default=10"`
+	} `hocon:"node=auth"`
+
+	// Tracing exports spans of HTTP handlers and scrapes in serve mode. They are sent to OTLP/HTTP
+	// Endpoint as JSON, e.g. http://localhost:4318/v1/traces, or written to stdout if it is not set.
+	// Headers are "Name: value" pairs separated by new lines, added to export requests.
+	Tracing struct {
+		Enabled     bool   `hocon:"node=enabled,default=false"`
+		Endpoint    string `hocon:"node=endpoint,default="`
+		Headers     string `hocon:"node=headers,default=" redact:"headers"`
+		ServiceName string `hocon:"node=serviceName,default=ticker-parser"`
+	} `hocon:"node=tracing"`
+
+	// Config is reloaded on SIGHUP and when the file changes, new values are applied without restart
+	// except server.port, grpc and storage.
+	Config struct {
+		WatchInterval int64 `hocon:"node=watchInterval,default=5"` // seconds between file checks, 0 disables
+	} `hocon:"node=config"`
+
 	Server struct {
-		Port int64 `hocon:"node=port,default=8080"`
+		Port            int64 `hocon:"node=port,default=8080"`
+		ShutdownTimeout int64 `hocon:"node=shutdownTimeout,default=30"` // seconds to drain in-flight requests
 	} `hocon:"node=server"`
 
+	// GRPC serves the API of proto/ticker_parser.proto on Port next to the HTTP API. Auth is applied
+	// to it the same way, the API key is sent in the metadata.
+	GRPC struct {
+		Enabled bool  `hocon:"node=enabled,default=false"`
+		Port    int64 `hocon:"node=port,default=9090"`
+	} `hocon:"node=grpc"`
+
+	// Stream configures GET /stream. Replay is the number of the last updates kept to resume streams
+	// by Last-Event-ID, Heartbeat is seconds between heartbeat comments.
+	Stream struct {
+		Replay    int64 `hocon:"node=replay,default=1000"`
+		Heartbeat int64 `hocon:"node=heartbeat,default=15"`
+	} `hocon:"node=stream"`
+
 	Filters struct {
 		ExtremeValues struct {
 			Enabled   bool    `hocon:"default=true"`
@@ -20,30 +73,117 @@ type Properties struct {
 		}
 	}
 
+	// Alerts rules are separated by ';' or new lines, see parseAlertRules for the syntax.
+	// Webhooks are comma separated URLs.
+	Alerts struct {
+		Rules       string `hocon:"default="`
+		Webhooks    string `hocon:"default=" redact:"urls"`
+		Secret      string `hocon:"default=" redact:"secret"`
+		Retries     int32  `hocon:"default=3"`
+		Backoff     int64  `hocon:"default=1"`    // seconds before the first retry, doubled for every next one
+		DedupWindow int64  `hocon:"default=3600"` // seconds to suppress repeated alerts of the same rule
+	}
+
 	Parser struct {
 		Catalog struct {
-			BaseUrl  string `hocon:"node=baseUrl,default=www"`
+			BaseUrl  string `hocon:"node=baseUrl,default=www" redact:"url"`
 			PageSize int16  `hocon:"node=pageSize,default=25"`
 		} `hocon:"node=catalog"`
 
-		URL string `hocon:"node=url,default=www.site.com"`
+		URL string `hocon:"node=url,default=www.site.com" redact:"url"`
+
+		// HTTP configures the client used for all upstream requests. Headers are "Name: value" pairs
+		// separated by new lines, proxy is http://, https:// or socks5:// URL.
+		HTTP struct {
+			ConnectTimeout int64  `hocon:"node=connectTimeout,default=10"` // seconds
+			ReadTimeout    int64  `hocon:"node=readTimeout,default=30"`    // seconds
+			Retries        int32  `hocon:"node=retries,default=3"`
+			Backoff        int64  `hocon:"node=backoff,default=1"`     // seconds before the first retry
+			MaxBackoff     int64  `hocon:"node=maxBackoff,default=30"` // seconds, longer Retry-After is not waited
+			UserAgent      string `hocon:"node=userAgent,default=ticker-parser"`
+			Headers        string `hocon:"node=headers,default=" redact:"headers"`
+			Proxy          string `hocon:"node=proxy,default=" redact:"url"`
+
+			// CircuitBreaker opens after Threshold consecutive failures of a host and fails fast
+			// until Cooldown seconds pass, then one probe request is let through.
+			CircuitBreaker struct {
+				Threshold int32 `hocon:"node=threshold,default=5"`
+				Cooldown  int64 `hocon:"node=cooldown,default=60"`
+			} `hocon:"node=circuitBreaker"`
+
+			// Cache keeps responses with ETag or Last-Modified in Path directory and revalidates them
+			// with conditional requests. It is disabled by default, so the process does not create files
+			// in its working directory, enable it with an absolute Path.
+			Cache struct {
+				Enabled bool   `hocon:"node=enabled,default=false"`
+				Path    string `hocon:"node=path,default=ticker-parser-cache"`
+			} `hocon:"node=cache"`
+
+			// Limits are maximum response body sizes in bytes, larger responses are rejected
+			// without reading them further. Zero means no limit.
+			Limits struct {
+				Catalog int64 `hocon:"node=catalog,default=1048576"`
+				Page    int64 `hocon:"node=page,default=5242880"`
+			} `hocon:"node=limits"`
+		} `hocon:"node=http"`
 	} `hocon:"node=parser"`
+
+	// Storage keeps the history of scrapes in Path bolt database. It is disabled by default, so the process
+	// does not create files in its working directory, enable it with an absolute Path.
+	Storage struct {
+		Enabled bool   `hocon:"node=enabled,default=false"`
+		Path    string `hocon:"node=path,default=ticker-parser.db"`
+	} `hocon:"node=storage"`
+
+	Scheduler struct {
+		Enabled  bool  `hocon:"node=enabled,default=false"`
+		Interval int64 `hocon:"node=interval,default=3600"` // seconds between scrapes
+	} `hocon:"node=scheduler"`
+
+	// Health configures /readyz checks. Readiness fails if there was no successful scrape within
+	// ScrapeWindow seconds, 0 disables the check.
+	Health struct {
+		ScrapeWindow int64 `hocon:"node=scrapeWindow,default=0"`
+	} `hocon:"node=health"`
+
+	Jobs struct {
+		TTL int64 `hocon:"node=ttl,default=3600"` // seconds to keep finished jobs
+	} `hocon:"node=jobs"`
 }
 
 var (
-	props *Properties
+	props        *Properties
+	propsOrigins map[string]propertyOrigin
+	propsMu      sync.RWMutex
 )
 
-// getProperties loads configuration from file to Properties struct if needed and gives pointer to it
+// getProperties loads configuration if needed and gives pointer to it, see loadProperties for the sources.
+// Command line flags are applied by initProperties. The properties must not be modified, reload replaces
+// them with the new instance.
 func getProperties() *Properties {
+	propsMu.RLock()
+	properties := props
+	propsMu.RUnlock()
+	if properties != nil {
+		return properties
+	}
+
+	propsMu.Lock()
+	defer propsMu.Unlock()
 	if props == nil {
-		props = &Properties{}
-		if err := hocon.LoadConfigFile("ticker-parser.conf", props); err != nil {
-			logrus.Warn("cannot load properties file ticker-parser.conf")
-			if err := hocon.LoadConfigText("", props); err != nil {
-				logrus.WithError(err).Fatal("cannot load properties")
-			}
+		loaded, err := loadProperties(nil, os.Environ())
+		if err != nil {
+			logrus.WithError(err).Fatal("cannot load properties")
 		}
+		props, propsOrigins = loaded.properties, loaded.origins
 	}
 	return props
 }
+
+// getPropertyOrigins returns origins of the current properties values by property path.
+func getPropertyOrigins() map[string]propertyOrigin {
+	getProperties()
+	propsMu.RLock()
+	defer propsMu.RUnlock()
+	return propsOrigins
+}
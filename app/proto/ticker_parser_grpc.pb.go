@@ -0,0 +1,249 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// TickerParserClient is the client API for TickerParser service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TickerParserClient interface {
+	// ListTickers scrapes tickers, or rebuilds them from the history if as_of is set.
+	// Requires refresh scope, or read scope with as_of.
+	ListTickers(ctx context.Context, in *ListTickersRequest, opts ...grpc.CallOption) (*ListTickersResponse, error)
+	// GetTicker returns one ticker of ListTickers, NOT_FOUND if it did not pass the filters.
+	GetTicker(ctx context.Context, in *GetTickerRequest, opts ...grpc.CallOption) (*Ticker, error)
+	// FetchCatalog fetches all catalog pages. Requires refresh scope.
+	FetchCatalog(ctx context.Context, in *FetchCatalogRequest, opts ...grpc.CallOption) (*FetchCatalogResponse, error)
+	// WatchConsensusChanges streams consensus changes made by scrapes until the call is cancelled or
+	// the server shuts down. Requires read scope.
+	WatchConsensusChanges(ctx context.Context, in *WatchConsensusChangesRequest, opts ...grpc.CallOption) (TickerParser_WatchConsensusChangesClient, error)
+}
+
+type tickerParserClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTickerParserClient(cc grpc.ClientConnInterface) TickerParserClient {
+	return &tickerParserClient{cc}
+}
+
+func (c *tickerParserClient) ListTickers(ctx context.Context, in *ListTickersRequest, opts ...grpc.CallOption) (*ListTickersResponse, error) {
+	out := new(ListTickersResponse)
+	err := c.cc.Invoke(ctx, "/tickerparser.v1.TickerParser/ListTickers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tickerParserClient) GetTicker(ctx context.Context, in *GetTickerRequest, opts ...grpc.CallOption) (*Ticker, error) {
+	out := new(Ticker)
+	err := c.cc.Invoke(ctx, "/tickerparser.v1.TickerParser/GetTicker", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tickerParserClient) FetchCatalog(ctx context.Context, in *FetchCatalogRequest, opts ...grpc.CallOption) (*FetchCatalogResponse, error) {
+	out := new(FetchCatalogResponse)
+	err := c.cc.Invoke(ctx, "/tickerparser.v1.TickerParser/FetchCatalog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tickerParserClient) WatchConsensusChanges(ctx context.Context, in *WatchConsensusChangesRequest, opts ...grpc.CallOption) (TickerParser_WatchConsensusChangesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TickerParser_ServiceDesc.Streams[0], "/tickerparser.v1.TickerParser/WatchConsensusChanges", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &tickerParserWatchConsensusChangesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TickerParser_WatchConsensusChangesClient interface {
+	Recv() (*ConsensusChange, error)
+	grpc.ClientStream
+}
+
+type tickerParserWatchConsensusChangesClient struct {
+	grpc.ClientStream
+}
+
+func (x *tickerParserWatchConsensusChangesClient) Recv() (*ConsensusChange, error) {
+	m := new(ConsensusChange)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TickerParserServer is the server API for TickerParser service.
+// All implementations must embed UnimplementedTickerParserServer
+// for forward compatibility
+type TickerParserServer interface {
+	// ListTickers scrapes tickers, or rebuilds them from the history if as_of is set.
+	// Requires refresh scope, or read scope with as_of.
+	ListTickers(context.Context, *ListTickersRequest) (*ListTickersResponse, error)
+	// GetTicker returns one ticker of ListTickers, NOT_FOUND if it did not pass the filters.
+	GetTicker(context.Context, *GetTickerRequest) (*Ticker, error)
+	// FetchCatalog fetches all catalog pages. Requires refresh scope.
+	FetchCatalog(context.Context, *FetchCatalogRequest) (*FetchCatalogResponse, error)
+	// WatchConsensusChanges streams consensus changes made by scrapes until the call is cancelled or
+	// the server shuts down. Requires read scope.
+	WatchConsensusChanges(*WatchConsensusChangesRequest, TickerParser_WatchConsensusChangesServer) error
+	mustEmbedUnimplementedTickerParserServer()
+}
+
+// UnimplementedTickerParserServer must be embedded to have forward compatible implementations.
+type UnimplementedTickerParserServer struct {
+}
+
+func (UnimplementedTickerParserServer) ListTickers(context.Context, *ListTickersRequest) (*ListTickersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTickers not implemented")
+}
+func (UnimplementedTickerParserServer) GetTicker(context.Context, *GetTickerRequest) (*Ticker, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTicker not implemented")
+}
+func (UnimplementedTickerParserServer) FetchCatalog(context.Context, *FetchCatalogRequest) (*FetchCatalogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FetchCatalog not implemented")
+}
+func (UnimplementedTickerParserServer) WatchConsensusChanges(*WatchConsensusChangesRequest, TickerParser_WatchConsensusChangesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchConsensusChanges not implemented")
+}
+func (UnimplementedTickerParserServer) mustEmbedUnimplementedTickerParserServer() {}
+
+// UnsafeTickerParserServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TickerParserServer will
+// result in compilation errors.
+type UnsafeTickerParserServer interface {
+	mustEmbedUnimplementedTickerParserServer()
+}
+
+func RegisterTickerParserServer(s grpc.ServiceRegistrar, srv TickerParserServer) {
+	s.RegisterService(&TickerParser_ServiceDesc, srv)
+}
+
+func _TickerParser_ListTickers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTickersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TickerParserServer).ListTickers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tickerparser.v1.TickerParser/ListTickers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TickerParserServer).ListTickers(ctx, req.(*ListTickersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TickerParser_GetTicker_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTickerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TickerParserServer).GetTicker(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tickerparser.v1.TickerParser/GetTicker",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TickerParserServer).GetTicker(ctx, req.(*GetTickerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TickerParser_FetchCatalog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchCatalogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TickerParserServer).FetchCatalog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tickerparser.v1.TickerParser/FetchCatalog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TickerParserServer).FetchCatalog(ctx, req.(*FetchCatalogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TickerParser_WatchConsensusChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchConsensusChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TickerParserServer).WatchConsensusChanges(m, &tickerParserWatchConsensusChangesServer{stream})
+}
+
+type TickerParser_WatchConsensusChangesServer interface {
+	Send(*ConsensusChange) error
+	grpc.ServerStream
+}
+
+type tickerParserWatchConsensusChangesServer struct {
+	grpc.ServerStream
+}
+
+func (x *tickerParserWatchConsensusChangesServer) Send(m *ConsensusChange) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// TickerParser_ServiceDesc is the grpc.ServiceDesc for TickerParser service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TickerParser_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tickerparser.v1.TickerParser",
+	HandlerType: (*TickerParserServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTickers",
+			Handler:    _TickerParser_ListTickers_Handler,
+		},
+		{
+			MethodName: "GetTicker",
+			Handler:    _TickerParser_GetTicker_Handler,
+		},
+		{
+			MethodName: "FetchCatalog",
+			Handler:    _TickerParser_FetchCatalog_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchConsensusChanges",
+			Handler:       _TickerParser_WatchConsensusChanges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ticker_parser.proto",
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// runScheduler scrapes tickers every configured interval, alert rules are checked by every scrape.
+// It returns when ctx is cancelled only, so it must be run in a goroutine.
+// The interval is read before every sleep, so reloaded value is applied after the next scrape.
+func runScheduler(ctx context.Context) {
+	schedulerLog.Infof("scheduler started, scrape interval is %ds", getProperties().Scheduler.Interval)
+
+	for {
+		scheduledScrape(ctx)
+		select {
+		case <-ctx.Done():
+			schedulerLog.Info("scheduler stopped")
+			return
+		case <-time.After(time.Duration(getProperties().Scheduler.Interval) * time.Second):
+		}
+	}
+}
+
+func scheduledScrape(ctx context.Context) {
+	ctx = withLogFields(ctx, log.Fields{"trigger": "scheduler"})
+	entry := logger(ctx, schedulerLog)
+	entry.Debug("scheduled scrape started")
+	result := runTheJob(ctx)
+	if result.err != nil {
+		entry.Errorf("scheduled scrape failed: %s", result.err)
+		return
+	}
+	entry.Debug("scheduled scrape finished")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// appContext is cancelled on shutdown, the scheduler, jobs and shared scrapes stop then.
+	appContext, stopApp = context.WithCancel(context.Background())
+
+	// shuttingDown is closed when the shutdown starts, streaming responses end then to let it finish.
+	shuttingDown     = make(chan struct{})
+	shuttingDownOnce sync.Once
+)
+
+// gracefulServer is run by runServer, *http.Server and *grpcServer implement it.
+type gracefulServer interface {
+	ListenAndServe() error
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+// runServer serves until a server fails or SIGTERM or SIGINT is received, then shuts the servers
+// down gracefully.
+func runServer(servers ...gracefulServer) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server gracefulServer) {
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+
+	select {
+	case err := <-errs:
+		serverLog.Error(err)
+		stopApp()
+		return exitFailure
+	case received := <-signals:
+		serverLog.Infof("%s received, shutting down", received)
+	}
+
+	shutdown(servers, time.Duration(getProperties().Server.ShutdownTimeout)*time.Second)
+	return exitOK
+}
+
+// shutdown stops accepting connections and waits for in-flight requests and gRPC calls during timeout.
+// Requests and calls still running after it are cancelled. Background work is stopped, queued spans
+// are exported and the history storage is closed at the end.
+func shutdown(servers []gracefulServer, timeout time.Duration) {
+	shuttingDownOnce.Do(func() { close(shuttingDown) })
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server gracefulServer) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				serverLog.Warnf("requests are not finished in %s, cancelling them: %s", timeout, err)
+				stopApp()
+				if err := server.Close(); err != nil {
+					serverLog.Errorf("cannot close server: %s", err)
+				}
+			}
+		}(server)
+	}
+	wg.Wait()
+	stopApp()
+
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), tracingBatchDelay)
+	defer tracingCancel()
+	stopTracing(tracingCtx)
+
+	if history != nil {
+		if err := history.Close(); err != nil {
+			serverLog.Errorf("cannot close history storage: %s", err)
+		}
+	}
+	serverLog.Info("server stopped")
+}
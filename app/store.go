@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+var (
+	// history keeps every scrape, it is nil when the storage is disabled.
+	history historyStore
+
+	// lastScrape is the previous scrape to detect changes when the storage is disabled.
+	lastScrape   *scrapeRecord
+	lastScrapeMu sync.Mutex
+
+	// recordMu serializes recording, so the previous scrape of every event is the one recorded before it.
+	recordMu sync.Mutex
+)
+
+// historyStore persists scrapes to chart how forecasts and consensus moved.
+type historyStore interface {
+	// SaveScrape stores given scrape and assigns ID to it.
+	SaveScrape(scrape *scrapeRecord) error
+	// Scrapes returns stored scrapes made between from and to inclusively, oldest first.
+	Scrapes(from time.Time, to time.Time) ([]scrapeRecord, error)
+	// LatestScrape returns the last stored scrape or nil if there is none.
+	LatestScrape() (*scrapeRecord, error)
+	// SaveChanges stores forecast changes detected by a scrape.
+	SaveChanges(changes []entities.ForecastChange) error
+	// Changes returns stored changes detected not earlier than since, oldest first.
+	Changes(since time.Time) ([]entities.ForecastChange, error)
+	Close() error
+}
+
+// scrapeEvent is a scrape compared to the previous one, Previous is nil for the very first scrape.
+type scrapeEvent struct {
+	Previous *scrapeRecord
+	Current  *scrapeRecord
+	Changes  []entities.ForecastChange
+}
+
+// scrapeRecord is a stored result of one scrape.
+type scrapeRecord struct {
+	ID      uint64         `json:"id"`
+	Time    time.Time      `json:"time"`
+	Tickers []tickerRecord `json:"tickers"`
+}
+
+// tickerRecord keeps all parsed forecasts of the ticker before filtering, so the consensus can be
+// rebuilt later. Consensus is nil if the ticker did not pass the filters.
+type tickerRecord struct {
+	Name      tickerName `json:"name"`
+	Price     float64    `json:"price"`
+	Consensus *float64   `json:"consensus"`
+	Forecasts []forecast `json:"forecasts"`
+}
+
+// newScrapeRecord compiles a record from parsed tickers and the tickers passed the filters.
+func newScrapeRecord(at time.Time, parsed *[]stockTicker, filtered *[]stockTicker) *scrapeRecord {
+	consensus := make(map[string]float64)
+	for _, ticker := range *filtered {
+		consensus[ticker.Name.Short] = ticker.Consensus
+	}
+
+	record := &scrapeRecord{Time: at}
+	for _, ticker := range *parsed {
+		tickerRecord := tickerRecord{Name: ticker.Name, Price: ticker.CurrentPrice}
+		if ticker.Forecasts != nil {
+			tickerRecord.Forecasts = append([]forecast{}, *ticker.Forecasts...)
+		}
+		if value, ok := consensus[ticker.Name.Short]; ok {
+			tickerRecord.Consensus = &value
+		}
+		record.Tickers = append(record.Tickers, tickerRecord)
+	}
+	return record
+}
+
+// lastScrapeTime returns the time of the last successful ticker scrape of this process.
+func lastScrapeTime() (time.Time, bool) {
+	lastScrapeMu.Lock()
+	defer lastScrapeMu.Unlock()
+	if lastScrape == nil {
+		return time.Time{}, false
+	}
+	return lastScrape.Time, true
+}
+
+// recordScrape saves the scrape and forecast changes since the previous one to the history if
+// the storage is enabled. Errors are logged only, a response must not fail because of the history.
+func recordScrape(at time.Time, parsed *[]stockTicker, filtered *[]stockTicker) *scrapeEvent {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
+	event := &scrapeEvent{Current: newScrapeRecord(at, parsed, filtered)}
+
+	lastScrapeMu.Lock()
+	event.Previous = lastScrape
+	lastScrape = event.Current
+	lastScrapeMu.Unlock()
+
+	if history == nil {
+		event.Changes = detectChanges(event.Previous, event.Current)
+		return event
+	}
+
+	if previous, err := history.LatestScrape(); err != nil {
+		historyLog.Errorf("cannot read previous scrape from history: %s", err)
+	} else if previous != nil {
+		event.Previous = previous
+	}
+
+	record := event.Current
+	if err := history.SaveScrape(record); err != nil {
+		historyLog.Errorf("cannot save scrape to history: %s", err)
+		return event
+	}
+	historyLog.Debugf("scrape %d saved to history, %d tickers", record.ID, len(record.Tickers))
+
+	event.Changes = detectChanges(event.Previous, record)
+	if err := history.SaveChanges(event.Changes); err != nil {
+		historyLog.Errorf("cannot save forecast changes to history: %s", err)
+		return event
+	}
+	historyLog.Debugf("%d forecast changes detected by scrape %d", len(event.Changes), record.ID)
+	return event
+}
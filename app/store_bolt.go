@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"math"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+var (
+	bucketMeta    = []byte("meta")
+	bucketScrapes = []byte("scrapes")
+	bucketChanges = []byte("changes")
+
+	keySchemaVersion = []byte("schemaVersion")
+)
+
+// boltMigration upgrades the database schema to its version, migrations are applied in order
+// and must never be changed after release, add a new one instead.
+type boltMigration struct {
+	version     uint64
+	description string
+	apply       func(tx *bolt.Tx) error
+}
+
+var boltMigrations = []boltMigration{
+	{
+		version:     1,
+		description: "create scrapes bucket",
+		apply: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bucketScrapes)
+			return err
+		},
+	},
+	{
+		version:     2,
+		description: "create forecast changes bucket",
+		apply: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bucketChanges)
+			return err
+		},
+	},
+}
+
+// boltStore is an embedded historyStore implementation. Scrapes are stored as JSON by the
+// time of scrape, so ranges are read with a cursor.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openBoltStore opens or creates the database file and migrates it to the latest schema version.
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open history database %s: %w", path, err)
+	}
+
+	store := &boltStore{db: db}
+	if err := store.migrate(boltMigrations); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies all migrations newer than the stored schema version in one transaction.
+func (ptr *boltStore) migrate(migrations []boltMigration) error {
+	return ptr.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+
+		var current uint64
+		if raw := meta.Get(keySchemaVersion); raw != nil {
+			current = binary.BigEndian.Uint64(raw)
+		}
+
+		latest := migrations[len(migrations)-1].version
+		if current > latest {
+			return fmt.Errorf("history database schema version %d is newer than supported %d", current, latest)
+		}
+
+		for _, migration := range migrations {
+			if migration.version <= current {
+				continue
+			}
+			historyLog.Infof("migrating history database to version %d: %s", migration.version, migration.description)
+			if err := migration.apply(tx); err != nil {
+				return fmt.Errorf("cannot migrate history database to version %d: %w", migration.version, err)
+			}
+			current = migration.version
+		}
+
+		return meta.Put(keySchemaVersion, uint64Key(current))
+	})
+}
+
+func (ptr *boltStore) SaveScrape(scrape *scrapeRecord) error {
+	return ptr.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketScrapes)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		scrape.ID = id
+
+		value, err := json.Marshal(scrape)
+		if err != nil {
+			return fmt.Errorf("cannot encode scrape: %w", err)
+		}
+		return bucket.Put(timeKey(scrape.Time, id), value)
+	})
+}
+
+func (ptr *boltStore) Scrapes(from time.Time, to time.Time) ([]scrapeRecord, error) {
+	var scrapes []scrapeRecord
+	err := ptr.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucketScrapes).Cursor()
+		max := timeKey(to, ^uint64(0))
+		for key, value := cursor.Seek(timeKey(from, 0)); key != nil && string(key) <= string(max); key, value = cursor.Next() {
+			var scrape scrapeRecord
+			if err := json.Unmarshal(value, &scrape); err != nil {
+				return fmt.Errorf("cannot decode scrape %x: %w", key, err)
+			}
+			scrapes = append(scrapes, scrape)
+		}
+		return nil
+	})
+	return scrapes, err
+}
+
+func (ptr *boltStore) LatestScrape() (*scrapeRecord, error) {
+	var scrape *scrapeRecord
+	err := ptr.db.View(func(tx *bolt.Tx) error {
+		key, value := tx.Bucket(bucketScrapes).Cursor().Last()
+		if key == nil {
+			return nil
+		}
+		scrape = &scrapeRecord{}
+		if err := json.Unmarshal(value, scrape); err != nil {
+			return fmt.Errorf("cannot decode scrape %x: %w", key, err)
+		}
+		return nil
+	})
+	return scrape, err
+}
+
+func (ptr *boltStore) SaveChanges(changes []entities.ForecastChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	return ptr.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketChanges)
+		for _, change := range changes {
+			id, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(change)
+			if err != nil {
+				return fmt.Errorf("cannot encode forecast change: %w", err)
+			}
+			if err := bucket.Put(timeKey(change.Time, id), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ptr *boltStore) Changes(since time.Time) ([]entities.ForecastChange, error) {
+	var changes []entities.ForecastChange
+	err := ptr.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucketChanges).Cursor()
+		for key, value := cursor.Seek(timeKey(since, 0)); key != nil; key, value = cursor.Next() {
+			var change entities.ForecastChange
+			if err := json.Unmarshal(value, &change); err != nil {
+				return fmt.Errorf("cannot decode forecast change %x: %w", key, err)
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	return changes, err
+}
+
+func (ptr *boltStore) Close() error {
+	return ptr.db.Close()
+}
+
+func uint64Key(value uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, value)
+	return key
+}
+
+// timeKey makes sortable key of the time and the sequence, sequence makes keys of the same time unique.
+// Times out of the UnixNano range are clamped, so zero time can be used as an open range bound.
+func timeKey(at time.Time, sequence uint64) []byte {
+	var nanos uint64
+	switch {
+	case at.Before(time.Unix(0, 0)):
+		nanos = 0
+	case at.After(time.Unix(0, math.MaxInt64)):
+		nanos = math.MaxInt64
+	default:
+		nanos = uint64(at.UnixNano())
+	}
+	return append(uint64Key(nanos), uint64Key(sequence)...)
+}
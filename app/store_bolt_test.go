@@ -0,0 +1,88 @@
+package main
+
+import (
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestBoltStore(t *testing.T) (*boltStore, func()) {
+	dir, err := ioutil.TempDir("", "ticker-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := openBoltStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		_ = store.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func Test_boltStore_Scrapes_returns_range(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+
+	start := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		consensus := float64(i)
+		record := &scrapeRecord{
+			Time: start.Add(time.Duration(i) * time.Hour),
+			Tickers: []tickerRecord{{
+				Name:      tickerName{Short: "SBER"},
+				Consensus: &consensus,
+				Forecasts: []forecast{{ID: "a", ExpectedDiff: consensus}},
+			}},
+		}
+		if err := store.SaveScrape(record); err != nil {
+			t.Fatalf("SaveScrape() error = %v", err)
+		}
+		if record.ID != uint64(i+1) {
+			t.Errorf("SaveScrape() ID = %d, want %d", record.ID, i+1)
+		}
+	}
+
+	got, err := store.Scrapes(start.Add(time.Hour), start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("Scrapes() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Scrapes() got %d scrapes, want 3", len(got))
+	}
+	if *got[0].Tickers[0].Consensus != 1 || *got[2].Tickers[0].Consensus != 3 {
+		t.Errorf("Scrapes() got wrong scrapes: %+v", got)
+	}
+
+	all, err := store.Scrapes(time.Time{}, start.AddDate(1000, 0, 0))
+	if err != nil {
+		t.Fatalf("Scrapes() error = %v", err)
+	}
+	if len(all) != 5 {
+		t.Errorf("Scrapes() with open range got %d scrapes, want 5", len(all))
+	}
+}
+
+func Test_boltStore_migrate_fails_on_newer_schema(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+
+	newer := append(boltMigrations, boltMigration{
+		version: boltMigrations[len(boltMigrations)-1].version + 1,
+		apply: func(tx *bolt.Tx) error {
+			return nil
+		},
+	})
+	if err := store.migrate(newer); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	if err := store.migrate(boltMigrations); err == nil {
+		t.Errorf("migrate() error = %v, wantErr %v", err, true)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	errorStreamUnsupported = 1701
+
+	streamMediaType = "text/event-stream"
+
+	streamEventUpdate = "update"
+	streamEventReset  = "reset"
+)
+
+var (
+	streamHandlerPath = "/stream"
+
+	streamClients = metrics.gauge("ticker_parser_stream_clients", "Connected clients of /stream.")
+)
+
+// streamHandler serves GET /stream?tickers=SBER,GAZP as Server-Sent Events. Every ticker update made by
+// a scrape is sent as "update" event with TickerUpdate data, all tickers are streamed if the tickers
+// parameter is not set. A comment is sent every stream.heartbeat seconds to keep the connection alive.
+// Reconnected clients get the updates since Last-Event-ID header, or lastEventId parameter, from
+// the replay buffer. If some of them are lost, "reset" event goes first.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	entry := requestLogger(r)
+	entry.Info("new request")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError := entities.WrapErrors("streaming is unsupported", errorStreamUnsupported, entities.HTTPErrorDetails{
+			Reason:       "response writer cannot flush",
+			Message:      "streaming is unsupported",
+			Location:     streamHandlerPath,
+			LocationType: "path",
+		})
+		writeHTTPResponse(w, http.StatusInternalServerError, entities.NewHTTPResponse(nil, httpError, 1, r.URL.Path))
+		return
+	}
+
+	var names []string
+	for _, value := range r.URL.Query()["tickers"] {
+		names = append(names, strings.Split(value, ",")...)
+	}
+	watched := watchedTickers(names)
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+
+	sub := tickerUpdates.subscribe(lastID)
+	defer sub.cancel()
+	streamClients.add(1)
+	defer streamClients.add(-1)
+
+	w.Header().Set("Content-Type", streamMediaType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(update feedUpdate) error {
+		if !watched(update.Ticker) {
+			return nil
+		}
+		return writeStreamEvent(w, tickerUpdates.eventID(update.seq), streamEventUpdate, update.TickerUpdate)
+	}
+
+	if sub.missed {
+		entry.Debugf("updates since %s are lost, %d kept updates are replayed", lastID, len(sub.backlog))
+		reset := entities.StreamReset{LastEventID: lastID, Message: "some updates are lost, reload the tickers"}
+		if err := writeStreamEvent(w, "", streamEventReset, reset); err != nil {
+			entry.Debugf("stream closed: %s", err)
+			return
+		}
+	}
+	for _, update := range sub.backlog {
+		if err := send(update); err != nil {
+			entry.Debugf("stream closed: %s", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(time.Duration(getProperties().Stream.Heartbeat) * time.Second)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			entry.Debug("stream closed by the client")
+			return
+		case <-shuttingDown:
+			entry.Debug("stream closed on shutdown")
+			return
+		case update, ok := <-sub.updates:
+			if !ok {
+				entry.Warn("stream closed, the client does not receive updates in time")
+				return
+			}
+			err = send(update)
+		case now := <-heartbeat.C:
+			_, err = fmt.Fprintf(w, ": heartbeat %s\n\n", now.UTC().Format(time.RFC3339))
+		}
+		if err != nil {
+			entry.Debugf("stream closed: %s", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeStreamEvent writes the event with JSON data, the id is omitted if it is empty.
+func writeStreamEvent(w io.Writer, id string, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+// readStreamEvent reads the next event of the stream, comments are returned as events without a name.
+func readStreamEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	event := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("cannot read stream: %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return event
+		}
+		if strings.HasPrefix(line, ":") {
+			event["comment"] = line
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		event[parts[0]] = parts[1]
+	}
+}
+
+func Test_streamHandler(t *testing.T) {
+	properties := validTestProperties(t)
+	properties.Stream.Heartbeat = 1
+	propsMu.Lock()
+	saved := props
+	props = properties
+	propsMu.Unlock()
+	defer func() {
+		propsMu.Lock()
+		props = saved
+		propsMu.Unlock()
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(streamHandler))
+	defer server.Close()
+
+	// every case watches its own ticker, so updates of other cases and tests are filtered out
+	tests := []struct {
+		name       string
+		ticker     string
+		lastID     func(before uint64) string
+		wantEvents []string
+	}{
+		{name: "resumed", ticker: "STRM1", lastID: tickerUpdates.eventID,
+			wantEvents: []string{"update price", "update consensus"}},
+		{name: "lost updates", ticker: "STRM2", lastID: func(uint64) string { return "other-5" },
+			wantEvents: []string{"reset", "update price", "update consensus"}},
+		{name: "new updates", ticker: "STRM3", lastID: func(uint64) string { return "" },
+			wantEvents: []string{"update consensus"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tickerUpdates.mu.Lock()
+			before := tickerUpdates.seq
+			tickerUpdates.mu.Unlock()
+			tickerUpdates.publish([]entities.TickerUpdate{
+				{Ticker: tt.ticker, Kinds: []string{updateKindPrice}},
+				{Ticker: "OTHER", Kinds: []string{updateKindPrice}},
+			}, 10)
+
+			request, _ := http.NewRequest(http.MethodGet, server.URL+"/stream?tickers="+strings.ToLower(tt.ticker), nil)
+			if lastID := tt.lastID(before); lastID != "" {
+				request.Header.Set("Last-Event-ID", lastID)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = response.Body.Close() }()
+			if contentType := response.Header.Get("Content-Type"); contentType != streamMediaType {
+				t.Fatalf("Content-Type = %s, want %s", contentType, streamMediaType)
+			}
+
+			tickerUpdates.publish([]entities.TickerUpdate{
+				{Ticker: "OTHER", Kinds: []string{updateKindConsensus}},
+				{Ticker: tt.ticker, Kinds: []string{updateKindConsensus}},
+			}, 10)
+
+			reader := bufio.NewReader(response.Body)
+			for i, want := range tt.wantEvents {
+				event := readStreamEvent(t, reader)
+				if want == streamEventReset {
+					if event["event"] != streamEventReset || event["id"] != "" {
+						t.Errorf("event %d = %v, want reset without id", i, event)
+					}
+					continue
+				}
+				var update entities.TickerUpdate
+				if err := json.Unmarshal([]byte(event["data"]), &update); err != nil {
+					t.Fatal(err)
+				}
+				if got := event["event"] + " " + strings.Join(update.Kinds, ","); got != want || update.Ticker != tt.ticker {
+					t.Errorf("event %d = %s of %s, want %s of %s", i, got, update.Ticker, want, tt.ticker)
+				}
+				if event["id"] == "" {
+					t.Errorf("event %d has no id", i)
+				}
+			}
+
+			event := readStreamEvent(t, reader)
+			if !strings.HasPrefix(event["comment"], ": heartbeat") {
+				t.Errorf("event = %v, want heartbeat after the updates", event)
+			}
+		})
+	}
+}
+
+func Test_writeStreamEvent(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	at := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	if err := writeStreamEvent(recorder, "a-1", streamEventUpdate, entities.TickerUpdate{Ticker: "SBER", Time: at}); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: a-1\nevent: update\ndata: {\"scrapeId\":0,\"time\":\"2020-03-20T12:00:00Z\",\"ticker\":\"SBER\"," +
+		"\"name\":\"\",\"kinds\":null,\"price\":0,\"previousPrice\":0,\"consensus\":null,\"previousConsensus\":null}\n\n"
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("writeStreamEvent() = %q, want %q", got, want)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"sort"
@@ -40,6 +42,9 @@ type tickerName struct {
 }
 
 type forecast struct {
+	ID           string    `json:"id"`
+	Analyst      string    `json:"analyst"`
+	Target       float64   `json:"target"`
 	ExpectedDiff float64   `json:"expectedDiff"`
 	Time         time.Time `json:"time"`
 }
@@ -56,12 +61,26 @@ func (ptr *forecast) String() string {
 	return fmt.Sprintf("%+f %s", ptr.ExpectedDiff, ptr.Time.String())
 }
 
-func filterOldForecasts(ticker *stockTicker) error {
+// forecastID returns stable identity of a forecast built from ticker, analyst and forecast date,
+// the same forecast gets the same id in every scrape.
+func forecastID(ticker string, analyst string, date time.Time) string {
+	hash := sha1.Sum([]byte(ticker + "|" + analyst + "|" + date.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(hash[:8])
+}
+
+// forecastActualMonths is how long forecasts stay actual, older ones are filtered out.
+const forecastActualMonths = 1
+
+// tickerFilter checks the ticker and removes unsuitable forecasts from it. Returns error if the ticker
+// must be dropped entirely. now is the time the filter treats as current.
+type tickerFilter func(ticker *stockTicker, now time.Time) error
+
+func filterOldForecasts(ticker *stockTicker, now time.Time) error {
 	/* Filter old forecasts */
 	var newForecasts []forecast
 	var count int
 	for _, forecast := range *ticker.Forecasts {
-		if forecast.Time.Before(time.Now().AddDate(0, -1, 0)) {
+		if forecast.Time.Before(now.AddDate(0, -forecastActualMonths, 0)) {
 			continue
 		}
 		newForecasts = append(newForecasts, forecast)
@@ -77,7 +96,7 @@ func filterOldForecasts(ticker *stockTicker) error {
 }
 
 //noinspection GoNilness
-func filterExtremeForecasts(ticker *stockTicker) error {
+func filterExtremeForecasts(ticker *stockTicker, _ time.Time) error {
 	/* Filter extreme values */
 	threshold := getProperties().Filters.ExtremeValues.Threshold
 	logrus.Debugf("threshold to exclude extreme value is %f", threshold)
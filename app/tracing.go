@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	spanStatusError = 2
+
+	traceparentHeader = "traceparent"
+
+	tracingQueueSize  = 2048
+	tracingBatchSize  = 512
+	tracingBatchDelay = 5 * time.Second
+)
+
+var (
+	// tracingServed enables tracing configuration, spans are collected in serve mode only.
+	tracingServed bool
+
+	activeTracer *tracer
+	tracerMu     sync.RWMutex
+
+	traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+)
+
+// spanContext identifies a span, the parent of new spans is taken from the context.
+type spanContext struct {
+	traceID string
+	spanID  string
+}
+
+type spanContextKey struct{}
+
+// span is a timed operation of a trace. All methods are safe for nil span which is returned while
+// the tracing is disabled.
+type span struct {
+	tracer     *tracer
+	context    spanContext
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+// startSpan starts a span as a child of the span of ctx and returns the context with the new span.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	tracerMu.RLock()
+	tracer := activeTracer
+	tracerMu.RUnlock()
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	parent, hasParent := ctx.Value(spanContextKey{}).(spanContext)
+	s := &span{
+		tracer:     tracer,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+	s.context.spanID = randomHex(8)
+	if hasParent {
+		s.context.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.context.traceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanContextKey{}, s.context), s
+}
+
+// withParentSpan returns ctx with the span of from, the spans started with ctx belong to the same trace.
+func withParentSpan(ctx context.Context, from context.Context) context.Context {
+	if parent, ok := from.Value(spanContextKey{}).(spanContext); ok {
+		return context.WithValue(ctx, spanContextKey{}, parent)
+	}
+	return ctx
+}
+
+// withRemoteParent returns the context with the parent span given in W3C traceparent header of the request
+// or metadata of the gRPC call.
+func withRemoteParent(ctx context.Context, header http.Header) context.Context {
+	match := traceparentPattern.FindStringSubmatch(header.Get(traceparentHeader))
+	if match == nil || match[1] == "00000000000000000000000000000000" || match[2] == "0000000000000000" {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, spanContext{traceID: match[1], spanID: match[2]})
+}
+
+func (ptr *span) setAttribute(key string, value interface{}) {
+	if ptr == nil {
+		return
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.attributes[key] = value
+}
+
+// recordError marks the span failed, the last error is kept.
+func (ptr *span) recordError(err error) {
+	if ptr == nil || err == nil {
+		return
+	}
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	ptr.err = err.Error()
+}
+
+// finish ends the span and queues it for export.
+func (ptr *span) finish() {
+	if ptr == nil {
+		return
+	}
+	ptr.mu.Lock()
+	ptr.end = time.Now()
+	ptr.mu.Unlock()
+	ptr.tracer.enqueue(ptr)
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		// ids must not be zero, the time is unique enough for a fallback
+		copy(buf, strconv.FormatInt(time.Now().UnixNano(), 36))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// tracer exports finished spans in batches from a goroutine, spans are dropped if the queue is full.
+type tracer struct {
+	serviceName string
+	export      func(payload []byte) error
+	queue       chan *span
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+func newTracer(serviceName string, export func(payload []byte) error) *tracer {
+	t := &tracer{
+		serviceName: serviceName,
+		export:      export,
+		queue:       make(chan *span, tracingQueueSize),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (ptr *tracer) enqueue(s *span) {
+	select {
+	case ptr.queue <- s:
+	default:
+		serverLog.Debugf("tracing queue is full, span %s dropped", s.name)
+	}
+}
+
+func (ptr *tracer) run() {
+	defer close(ptr.stopped)
+	ticker := time.NewTicker(tracingBatchDelay)
+	defer ticker.Stop()
+
+	var batch []*span
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		payload, err := json.Marshal(otlpTraces(ptr.serviceName, batch))
+		if err == nil {
+			err = ptr.export(payload)
+		}
+		if err != nil {
+			serverLog.Warnf("cannot export %d spans: %s", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-ptr.queue:
+			batch = append(batch, s)
+			if len(batch) >= tracingBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-ptr.stop:
+			ptr.drain(&batch)
+			send()
+			return
+		}
+	}
+}
+
+func (ptr *tracer) drain(batch *[]*span) {
+	for {
+		select {
+		case s := <-ptr.queue:
+			*batch = append(*batch, s)
+		default:
+			return
+		}
+	}
+}
+
+// shutdown exports queued spans and stops the tracer, it waits until ctx is done at most.
+func (ptr *tracer) shutdown(ctx context.Context) {
+	close(ptr.stop)
+	select {
+	case <-ptr.stopped:
+	case <-ctx.Done():
+	}
+}
+
+// configureTracing replaces the active tracer according to the properties, the previous one exports
+// its spans before it stops. Spans are sent to OTLP/HTTP endpoint as JSON or written to stdout if
+// the endpoint is not set.
+func configureTracing(properties *Properties) {
+	config := properties.Tracing
+	var next *tracer
+	if config.Enabled {
+		export := writeSpans(os.Stdout)
+		if config.Endpoint != "" {
+			headers, err := parseHeaders(config.Headers)
+			if err != nil {
+				serverLog.Errorf("cannot parse tracing.headers, spans are written to stdout: %s", err)
+			} else {
+				export = postSpans(config.Endpoint, headers)
+			}
+		}
+		next = newTracer(config.ServiceName, export)
+	}
+
+	tracerMu.Lock()
+	previous := activeTracer
+	activeTracer = next
+	tracerMu.Unlock()
+
+	if previous != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingBatchDelay)
+		defer cancel()
+		previous.shutdown(ctx)
+	}
+}
+
+// stopTracing exports queued spans and disables the tracing.
+func stopTracing(ctx context.Context) {
+	tracerMu.Lock()
+	previous := activeTracer
+	activeTracer = nil
+	tracerMu.Unlock()
+
+	if previous != nil {
+		previous.shutdown(ctx)
+	}
+}
+
+// writeSpans writes every batch as one line of OTLP JSON.
+func writeSpans(w io.Writer) func(payload []byte) error {
+	var mu sync.Mutex
+	return func(payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := w.Write(append(payload, '\n'))
+		return err
+	}
+}
+
+// postSpans sends every batch to OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces.
+func postSpans(endpoint string, headers http.Header) func(payload []byte) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(payload []byte) error {
+		request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		for name, values := range headers {
+			request.Header[name] = values
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = response.Body.Close() }()
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		if response.StatusCode/100 != 2 {
+			return fmt.Errorf("collector responded with status code %d", response.StatusCode)
+		}
+		return nil
+	}
+}
+
+// otlpTraces converts spans to ExportTraceServiceRequest of OTLP JSON encoding.
+func otlpTraces(serviceName string, spans []*span) map[string]interface{} {
+	var otlpSpans []map[string]interface{}
+	for _, s := range spans {
+		s.mu.Lock()
+		otlpSpan := map[string]interface{}{
+			"traceId":           s.context.traceID,
+			"spanId":            s.context.spanID,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+		}
+		if s.parentID != "" {
+			otlpSpan["parentSpanId"] = s.parentID
+		}
+		if s.err != "" {
+			otlpSpan["status"] = map[string]interface{}{"code": spanStatusError, "message": s.err}
+		}
+		s.mu.Unlock()
+		otlpSpans = append(otlpSpans, otlpSpan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "ticker-parser", "version": revision},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := []map[string]interface{}{}
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch typed := attributes[key].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": typed}
+		case bool:
+			value = map[string]interface{}{"boolValue": typed}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(typed)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(typed, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": typed}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(typed)}
+		}
+		list = append(list, map[string]interface{}{"key": key, "value": value})
+	}
+	return list
+}
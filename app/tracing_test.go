@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_startSpan_exports_otlp_json(t *testing.T) {
+	var buf bytes.Buffer
+	tracerMu.Lock()
+	activeTracer = newTracer("test-service", writeSpans(&buf))
+	tracerMu.Unlock()
+
+	request := httptest.NewRequest(http.MethodGet, "/ticker/", nil)
+	request.Header.Set(traceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	ctx, parent := startSpan(withRemoteParent(context.Background(), request.Header), "parent", spanKindServer)
+	_, child := startSpan(ctx, "child", spanKindInternal)
+	child.setAttribute("catalog.items", 25)
+	child.recordError(errors.New("failure"))
+	child.finish()
+	parent.finish()
+	stopTracing(context.Background())
+
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Attributes   []struct {
+						Key   string            `json:"key"`
+						Value map[string]string `json:"value"`
+					} `json:"attributes"`
+					Status *struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		t.Fatalf("cannot parse exported spans %q: %s", buf.String(), err)
+	}
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+
+	exportedChild, exportedParent := spans[0], spans[1]
+	if exportedParent.TraceID != "0af7651916cd43dd8448eb211c80319c" || exportedParent.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("parent span trace = %s, parent = %s, want remote parent", exportedParent.TraceID, exportedParent.ParentSpanID)
+	}
+	if exportedChild.TraceID != exportedParent.TraceID || exportedChild.ParentSpanID != exportedParent.SpanID {
+		t.Errorf("child span trace = %s, parent = %s, want child of %s", exportedChild.TraceID,
+			exportedChild.ParentSpanID, exportedParent.SpanID)
+	}
+	if exportedChild.Status == nil || exportedChild.Status.Code != spanStatusError || exportedChild.Status.Message != "failure" {
+		t.Errorf("child span status = %+v, want error", exportedChild.Status)
+	}
+	if len(exportedChild.Attributes) != 1 || exportedChild.Attributes[0].Value["intValue"] != "25" {
+		t.Errorf("child span attributes = %+v, want catalog.items 25", exportedChild.Attributes)
+	}
+}
+
+func Test_startSpan_disabled(t *testing.T) {
+	stopTracing(context.Background())
+	ctx, span := startSpan(context.Background(), "test", spanKindInternal)
+	if span != nil || ctx != context.Background() {
+		t.Errorf("startSpan() span = %v while tracing is disabled, want nil", span)
+	}
+	span.setAttribute("key", "value")
+	span.recordError(errors.New("failure"))
+	span.finish()
+}
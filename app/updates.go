@@ -0,0 +1,213 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	updateKindConsensus = "consensus"
+	updateKindPrice     = "price"
+	updateKindForecasts = "forecasts"
+
+	// updateFeedBuffer is the number of updates a subscriber may lag behind before it is unsubscribed.
+	updateFeedBuffer = 256
+)
+
+// tickerUpdates delivers updates made by every scrape to streaming APIs.
+var tickerUpdates = newUpdateFeed()
+
+// detectUpdates compares tickers of the scrape with the previous scrape and returns the tickers with
+// changed consensus, price or forecasts. Tickers absent in any of the scrapes are skipped as
+// detectChanges does.
+func detectUpdates(event *scrapeEvent) []entities.TickerUpdate {
+	if event == nil || event.Previous == nil {
+		return nil
+	}
+
+	previousTickers := make(map[string]tickerRecord)
+	for _, ticker := range event.Previous.Tickers {
+		previousTickers[ticker.Name.Short] = ticker
+	}
+	changes := make(map[string][]entities.ForecastChange)
+	for _, change := range event.Changes {
+		changes[change.Ticker] = append(changes[change.Ticker], change)
+	}
+
+	var updates []entities.TickerUpdate
+	for _, ticker := range event.Current.Tickers {
+		previous, ok := previousTickers[ticker.Name.Short]
+		if !ok {
+			continue
+		}
+
+		update := entities.TickerUpdate{
+			ScrapeID:          event.Current.ID,
+			Time:              event.Current.Time,
+			Ticker:            ticker.Name.Short,
+			Name:              ticker.Name.Full,
+			Price:             ticker.Price,
+			PreviousPrice:     previous.Price,
+			Consensus:         ticker.Consensus,
+			PreviousConsensus: previous.Consensus,
+			Changes:           changes[ticker.Name.Short],
+		}
+		if !sameConsensus(previous.Consensus, ticker.Consensus) {
+			update.Kinds = append(update.Kinds, updateKindConsensus)
+		}
+		if previous.Price != ticker.Price {
+			update.Kinds = append(update.Kinds, updateKindPrice)
+		}
+		if len(update.Changes) != 0 {
+			update.Kinds = append(update.Kinds, updateKindForecasts)
+		}
+		if len(update.Kinds) != 0 {
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+func sameConsensus(a *float64, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// hasUpdateKind reports whether the update changed given kind.
+func hasUpdateKind(update entities.TickerUpdate, kind string) bool {
+	for _, k := range update.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// feedUpdate is an update with its sequence number in the feed.
+type feedUpdate struct {
+	seq uint64
+	entities.TickerUpdate
+}
+
+// updateFeed fans updates out to subscribers and keeps the last of them to resume subscriptions.
+// Publishing never blocks a scrape, a subscriber which does not keep up is unsubscribed.
+type updateFeed struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	replay      []feedUpdate
+	subscribers map[chan feedUpdate]struct{}
+}
+
+func newUpdateFeed() *updateFeed {
+	return &updateFeed{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: make(map[chan feedUpdate]struct{}),
+	}
+}
+
+// eventID identifies the update for resuming, the epoch tells ids given by another process apart.
+func (ptr *updateFeed) eventID(seq uint64) string {
+	return ptr.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// subscription receives updates of the feed. Backlog are kept updates published after the one
+// the subscription resumes from, missed is true if some of them are not kept anymore. Updates
+// channel is closed if the subscriber does not keep up.
+type subscription struct {
+	backlog []feedUpdate
+	missed  bool
+	updates <-chan feedUpdate
+	cancel  func()
+}
+
+// subscribe subscribes to updates published after the one with lastID, new updates only if it is empty.
+func (ptr *updateFeed) subscribe(lastID string) *subscription {
+	ch := make(chan feedUpdate, updateFeedBuffer)
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+
+	sub := &subscription{updates: ch}
+	if lastID != "" {
+		sub.backlog, sub.missed = ptr.since(lastID)
+	}
+	ptr.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	sub.cancel = func() {
+		once.Do(func() {
+			ptr.mu.Lock()
+			defer ptr.mu.Unlock()
+			ptr.remove(ch)
+		})
+	}
+	return sub
+}
+
+// since returns kept updates published after the one with lastID and whether some of them are lost.
+// All kept updates are returned for unknown ids.
+func (ptr *updateFeed) since(lastID string) ([]feedUpdate, bool) {
+	parts := strings.SplitN(lastID, "-", 2)
+	if len(parts) != 2 || parts[0] != ptr.epoch {
+		return append([]feedUpdate(nil), ptr.replay...), true
+	}
+	last, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || last > ptr.seq {
+		return append([]feedUpdate(nil), ptr.replay...), true
+	}
+
+	var backlog []feedUpdate
+	for _, update := range ptr.replay {
+		if update.seq > last {
+			backlog = append(backlog, update)
+		}
+	}
+	missed := last < ptr.seq && (len(backlog) == 0 || backlog[0].seq != last+1)
+	return backlog, missed
+}
+
+func (ptr *updateFeed) remove(ch chan feedUpdate) {
+	if _, ok := ptr.subscribers[ch]; ok {
+		delete(ptr.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the updates to subscribers and keeps the last replay of all published updates.
+func (ptr *updateFeed) publish(updates []entities.TickerUpdate, replay int) {
+	ptr.mu.Lock()
+	defer ptr.mu.Unlock()
+	for _, update := range updates {
+		ptr.seq++
+		published := feedUpdate{seq: ptr.seq, TickerUpdate: update}
+		ptr.replay = append(ptr.replay, published)
+		for ch := range ptr.subscribers {
+			select {
+			case ch <- published:
+			default:
+				serverLog.Warnf("subscriber is too slow, it is unsubscribed at update %d", published.seq)
+				ptr.remove(ch)
+			}
+		}
+	}
+	if over := len(ptr.replay) - replay; over > 0 {
+		ptr.replay = append([]feedUpdate(nil), ptr.replay[over:]...)
+	}
+}
+
+// watchedTickers returns the filter of tickers by short names, case insensitive. All tickers pass if
+// names are empty.
+func watchedTickers(names []string) func(short string) bool {
+	watched := make(map[string]bool)
+	for _, name := range names {
+		watched[strings.ToUpper(name)] = true
+	}
+	return func(short string) bool {
+		return len(watched) == 0 || watched[strings.ToUpper(short)]
+	}
+}
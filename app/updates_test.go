@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+func Test_detectUpdates(t *testing.T) {
+	at := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	consensus := func(value float64) *float64 {
+		return &value
+	}
+	record := func(short string, price float64, value *float64) tickerRecord {
+		return tickerRecord{Name: tickerName{Full: short + " full", Short: short}, Price: price, Consensus: value}
+	}
+
+	event := &scrapeEvent{
+		Previous: &scrapeRecord{ID: 1, Time: at.Add(-time.Hour), Tickers: []tickerRecord{
+			record("SAME", 100, consensus(10)),
+			record("CONS", 100, consensus(10)),
+			record("PRICE", 100, consensus(10)),
+			record("FILTERED", 100, consensus(10)),
+			record("FCST", 100, nil),
+			record("GONE", 100, consensus(10)),
+		}},
+		Current: &scrapeRecord{ID: 2, Time: at, Tickers: []tickerRecord{
+			record("SAME", 100, consensus(10)),
+			record("CONS", 100, consensus(12)),
+			record("PRICE", 110, consensus(10)),
+			record("FILTERED", 100, nil),
+			record("FCST", 100, nil),
+			record("NEW", 100, consensus(10)),
+		}},
+		Changes: []entities.ForecastChange{{Ticker: "FCST", Type: changeTypeNew}},
+	}
+
+	want := map[string]string{
+		"CONS":     updateKindConsensus,
+		"PRICE":    updateKindPrice,
+		"FILTERED": updateKindConsensus,
+		"FCST":     updateKindForecasts,
+	}
+	got := detectUpdates(event)
+	if len(got) != len(want) {
+		t.Fatalf("detectUpdates() got %d updates %+v, want %d", len(got), got, len(want))
+	}
+	for _, update := range got {
+		if kinds := strings.Join(update.Kinds, ","); kinds != want[update.Ticker] {
+			t.Errorf("detectUpdates() %s kinds = %s, want %s", update.Ticker, kinds, want[update.Ticker])
+		}
+		if update.ScrapeID != 2 || !update.Time.Equal(at) || update.Name != update.Ticker+" full" {
+			t.Errorf("detectUpdates() %s = %+v, want scrape 2 at %s", update.Ticker, update, at)
+		}
+	}
+
+	if updates := detectUpdates(&scrapeEvent{Current: event.Current}); updates != nil {
+		t.Errorf("detectUpdates() = %+v for the first scrape, want nil", updates)
+	}
+}
+
+func Test_updateFeed(t *testing.T) {
+	feed := newUpdateFeed()
+	sub := feed.subscribe("")
+
+	feed.publish([]entities.TickerUpdate{{Ticker: "SBER"}}, 2)
+	if update := <-sub.updates; update.Ticker != "SBER" || update.seq != 1 {
+		t.Errorf("subscriber got %+v, want the first SBER update", update)
+	}
+
+	slow := make([]entities.TickerUpdate, updateFeedBuffer+1)
+	feed.publish(slow, 2)
+	for range sub.updates {
+	}
+	if len(feed.subscribers) != 0 {
+		t.Errorf("feed has %d subscribers, the slow one must be unsubscribed", len(feed.subscribers))
+	}
+	sub.cancel()
+
+	last := feed.seq
+	tests := []struct {
+		name       string
+		lastID     string
+		wantSeqs   []uint64
+		wantMissed bool
+	}{
+		{name: "new updates only", lastID: ""},
+		{name: "up to date", lastID: feed.eventID(last)},
+		{name: "resumed", lastID: feed.eventID(last - 1), wantSeqs: []uint64{last}},
+		{name: "replay exceeded", lastID: feed.eventID(last - 5), wantSeqs: []uint64{last - 1, last}, wantMissed: true},
+		{name: "another process", lastID: "other-1", wantSeqs: []uint64{last - 1, last}, wantMissed: true},
+		{name: "from the future", lastID: feed.eventID(last + 1), wantSeqs: []uint64{last - 1, last}, wantMissed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := feed.subscribe(tt.lastID)
+			defer sub.cancel()
+			if sub.missed != tt.wantMissed || len(sub.backlog) != len(tt.wantSeqs) {
+				t.Fatalf("subscribe() = %d updates, missed %v, want %v, %v", len(sub.backlog), sub.missed,
+					tt.wantSeqs, tt.wantMissed)
+			}
+			for i, update := range sub.backlog {
+				if update.seq != tt.wantSeqs[i] {
+					t.Errorf("backlog[%d] = %d, want %d", i, update.seq, tt.wantSeqs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"ticker-parser/app/entities"
+	"time"
+)
+
+const (
+	webhookSignatureHeader = "X-Ticker-Parser-Signature"
+	webhookAlertIDHeader   = "X-Ticker-Parser-Alert"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// deliverAlert posts the alert as JSON to the webhook. The body is signed with HMAC-SHA256 of the secret
+// if it is set. Network errors, 429 and 5xx responses are retried given number of times, the backoff is
+// doubled every retry. Other responses are not retried, the webhook would reject the alert again.
+// Errors and logs show the redacted webhook URL only.
+func deliverAlert(webhookURL string, secret string, alert entities.Alert, retries int, backoff time.Duration) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("cannot encode alert: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(webhookURL, secret, alert.ID, body)
+		if err == nil {
+			alertsLog.Debugf("alert %s delivered to %s", alert.ID, redactString(redactURLs, webhookURL))
+			return nil
+		}
+		var statusError *webhookStatusError
+		if errors.As(err, &statusError) && !retryableStatus(statusError.statusCode) {
+			return fmt.Errorf("alert rejected: %w", err)
+		}
+		if attempt >= retries {
+			return fmt.Errorf("%d attempts failed, last error: %w", attempt+1, err)
+		}
+
+		alertsLog.Debugf("cannot deliver alert %s to %s, retry in %s: %s", alert.ID,
+			redactString(redactURLs, webhookURL), backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postWebhook(webhookURL string, secret string, alertID string, body []byte) error {
+	redacted := redactString(redactURLs, webhookURL)
+	request, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request to webhook (%s)", redacted)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhookAlertIDHeader, alertID)
+	if secret != "" {
+		request.Header.Set(webhookSignatureHeader, signWebhookBody(secret, body))
+	}
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		var urlError *url.Error
+		if errors.As(err, &urlError) {
+			urlError.URL = redacted
+		}
+		return err
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			alertsLog.Error(fmt.Errorf("cannot close response from (%s) body: %w", redacted, err))
+		}
+	}()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &webhookStatusError{url: redacted, statusCode: response.StatusCode}
+	}
+	return nil
+}
+
+// webhookStatusError is returned when the webhook responds with non-2xx status code, url is redacted.
+type webhookStatusError struct {
+	url        string
+	statusCode int
+}
+
+func (ptr *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook (%s) responded with status code %d", ptr.url, ptr.statusCode)
+}
+
+// signWebhookBody returns the signature header value: sha256=<hex of HMAC-SHA256 of the body>.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
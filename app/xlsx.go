@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Styles of xlsx cells, indexes of cellXfs in xlsxStyles.
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleNumber  = 1 // two decimal places
+	xlsxStyleDate    = 2 // dd.mm.yyyy
+	xlsxStyleHeader  = 3 // bold
+)
+
+// xlsxStyles defines number formats explicitly, so separators and date order follow the spreadsheet
+// locale while the values stay numeric.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="dd.mm.yyyy"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+</styleSheet>`
+
+// xlsxSheet is a worksheet with the header row. Cells are strings, float64 (two decimal places),
+// int or time.Time (date).
+type xlsxSheet struct {
+	name   string
+	header []string
+	rows   [][]interface{}
+}
+
+// writeXLSX writes minimal Office Open XML workbook with given sheets.
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	archive := zip.NewWriter(w)
+
+	var contentTypes, workbook, workbookRels bytes.Buffer
+	contentTypes.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+`)
+
+	parts := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"}
+	content := map[string][]byte{
+		"_rels/.rels": []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`),
+		"xl/styles.xml": []byte(xlsxStyles),
+	}
+	for i, sheet := range sheets {
+		n := i + 1
+		part := fmt.Sprintf("xl/worksheets/sheet%d.xml", n)
+		fmt.Fprintf(&contentTypes, `<Override PartName="/%s" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", part)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", n, n)
+
+		data, err := sheet.xml()
+		if err != nil {
+			return err
+		}
+		parts = append(parts, part)
+		content[part] = data
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+	content["[Content_Types].xml"] = contentTypes.Bytes()
+	content["xl/workbook.xml"] = workbook.Bytes()
+	content["xl/_rels/workbook.xml.rels"] = workbookRels.Bytes()
+
+	for _, part := range parts {
+		file, err := archive.Create(part)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(content[part]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (ptr *xlsxSheet) xml() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(ptr.header))
+	for i, title := range ptr.header {
+		header[i] = title
+	}
+	rows := append([][]interface{}{header}, ptr.rows...)
+	for r, row := range rows {
+		fmt.Fprintf(&buffer, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			style := xlsxStyleDefault
+			if r == 0 {
+				style = xlsxStyleHeader
+			}
+			switch v := value.(type) {
+			case string:
+				fmt.Fprintf(&buffer, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, style, xmlEscape(v))
+			case float64:
+				fmt.Fprintf(&buffer, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleNumber,
+					strconv.FormatFloat(v, 'f', -1, 64))
+			case int:
+				fmt.Fprintf(&buffer, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+			case time.Time:
+				fmt.Fprintf(&buffer, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleDate,
+					strconv.FormatFloat(xlsxDate(v), 'f', -1, 64))
+			default:
+				return nil, fmt.Errorf("unsupported xlsx cell type %T", value)
+			}
+		}
+		buffer.WriteString(`</row>`)
+	}
+	buffer.WriteString(`</sheetData></worksheet>`)
+	return buffer.Bytes(), nil
+}
+
+// xlsxColumn returns the column letters of zero based index: A, B, ..., Z, AA, ...
+func xlsxColumn(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxDate returns spreadsheet serial date: days since 30 Dec 1899 of the time wall clock.
+func xlsxDate(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+func xmlEscape(value string) string {
+	var buffer bytes.Buffer
+	_ = xml.EscapeText(&buffer, []byte(value))
+	return buffer.String()
+}
@@ -1,10 +1,15 @@
 module ticker-parser
 
-go 1.13
+go 1.14
 
 require (
 	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/artemkaxboy/configuration v0.0.0-20200109034048-a3def9c7c257
 	github.com/artemkaxboy/go-hocon v0.3.1
+	github.com/golang/protobuf v1.4.3
 	github.com/sirupsen/logrus v1.4.2
-	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20200822124328-c89045814202
+	google.golang.org/grpc v1.40.1
+	google.golang.org/protobuf v1.25.0
 )